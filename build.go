@@ -1,6 +1,7 @@
 package slurp
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"os/signal"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -37,27 +39,58 @@ type Build struct {
 
 	Tasks taskstack
 
+	// KeepGoing runs all the tasks that don't depend on a failed task
+	// to completion, by default the first failure cancels the run.
+	KeepGoing bool
+
+	// DryRun runs the tasks as a dry run, like the -n flag, see C.DryRun.
+	DryRun bool
+
+	// The tasks in dependency order, nil until the graph is validated.
+	order []*task
+	// The resolved dependencies of every task, replaced as a whole when
+	// the graph is validated, so the running tasks are never affected.
+	deps  map[string][]*task
+	graph sync.Mutex
+
 	shortnames map[string]string
 
+	// Holds back the messages of the running tasks, nil unless the
+	// output is grouped.
+	group *log.Group
+	// Draws the progress on terminals, nil otherwise.
+	live *log.Live
+
+	// The state of the incremental tasks.
+	state state
+
 	cleanups    []func()
 	runcleanups bool
 
-	done chan struct{}
-	lock sync.Mutex
+	cancel context.CancelFunc
+	lock   sync.Mutex
 }
 
 func NewBuild() *Build {
-	done := make(chan struct{})
-	return &Build{C: &C{Log: log.New(), done: done}, Tasks: make(taskstack), done: done, lock: sync.Mutex{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Build{C: &C{Context: ctx, Log: log.New()}, Tasks: make(taskstack), cancel: cancel, lock: sync.Mutex{}}
 }
 
 // Register Tasks.
+// Tasks can be registered in any order, the dependencies are resolved
+// when the build is validated before running.
 // When running the task, the dependencies will be run in parallel.
 // Circular Dependencies are not allowed and will result into error.
 func (b *Build) Task(tasks ...Task) {
 
 	b.lock.Lock()
 	defer b.lock.Unlock()
+
+	// The running tasks only read the graph with the lock held.
+	b.graph.Lock()
+	defer b.graph.Unlock()
+	b.order = nil
+
 	for i, T := range tasks {
 		if T.Name == "" {
 			b.Error("Task %d Missing Name.", i)
@@ -74,45 +107,56 @@ func (b *Build) Task(tasks ...Task) {
 		if _, ok := b.Tasks[T.Name]; ok {
 			b.Fatalf("Duplicate task: %s", T.Name)
 		}
-		t := &task{Task: T, deps: make(taskstack), done: b.done, running: false}
-
-		for _, dep := range t.Deps {
-			d, ok := b.Tasks[dep]
-			if !ok {
-				b.Fatalf("Missing Task %s. Required by Task %s.", dep, t.Name)
-			}
-			_, ok = d.deps[t.Name]
-			if ok {
-				b.Fatalf("Circular dependency %s requies %s and around.", d.Name, t.Name)
-			}
-			t.deps[dep] = d
-		}
-
-		b.Tasks[t.Name] = t
+		b.Tasks[T.Name] = &task{Task: T}
 	}
 }
 
+// Start runs the tasks in parallel and returns a Waiter for them.
+// Tasks started with a context from a running task are part of that
+// run, and just like dependencies, they are not executed again if they
+// have already been started.
 func (b *Build) Start(c *C, tasks ...string) Waiter {
+	if err := b.Validate(); err != nil {
+		b.Fatal(err)
+	}
+
 	var wg sync.WaitGroup
+
+	r := c.run
+	if r == nil {
+		r = newRun(b, c)
+		defer func() {
+			go r.wait(&wg)
+		}()
+	}
+
 	for _, name := range tasks {
-		task, ok := b.Tasks[name]
+		b.graph.Lock()
+		t, ok := b.Tasks[name]
+		b.graph.Unlock()
 		if !ok {
 			b.Fatalf("No Such Task: %s", name)
 			break
 		}
 		wg.Add(1)
-		go func() {
+		go func(t *task) {
 			defer wg.Done()
-			err := task.run(c)
+			err := r.do(t)
 			if err != nil {
 				b.Error(err)
 			}
-		}()
+		}(t)
 	}
 
 	return &wg
 }
 
+// wait releases the run once all of its tasks are done.
+func (r *run) wait(w Waiter) {
+	w.Wait()
+	r.cancel()
+}
+
 // Run Starts a task and waits for it to finish.
 func (b *Build) Run(c *C, tasks ...string) {
 	b.Start(c, tasks...).Wait()
@@ -126,22 +170,25 @@ func (b *Build) Defer(fn func()) {
 }
 
 // Stop a build, it will call all the cleanup functions.
-// Returns an error on timeout.
+// The returned channel gets an error if the build is already canceled
+// and is closed once the running tasks are done.
 func (b *Build) Cancel() <-chan error {
 
-	errs := make(chan error)
+	errs := make(chan error, 1)
 	go func() {
+		defer close(errs)
 		b.lock.Lock()
 		defer b.lock.Unlock()
-		close(b.done)
 
-		if b.done == nil {
+		if b.Err() != nil {
 			errs <- errors.New("Already Cancelled.")
+			return
 		}
+		b.cancel()
 
 		running := make(map[string]struct{})
 		for _, t := range b.Tasks {
-			if t.running {
+			if atomic.LoadInt32(&t.running) == 1 {
 				running[t.Name] = struct{}{}
 			}
 		}
@@ -150,7 +197,7 @@ func (b *Build) Cancel() <-chan error {
 		for count > 0 {
 			time.Sleep(time.Second)
 			for name, _ := range running {
-				if b.Tasks[name].running {
+				if atomic.LoadInt32(&b.Tasks[name].running) == 1 {
 					b.Noticef("Waiting for %s to finish.", name)
 				} else {
 					delete(running, name)
@@ -174,65 +221,171 @@ func (b *Build) Cleanup() {
 	}
 }
 
+// parse splits the command-line arguments into task names and parses
+// the flags that follow each task with the task's own FlagSet.
+// That is, `deploy -env=staging build -minify`.
+func (b *Build) parse(args []string) ([]string, error) {
+	var tasks []string
+	for len(args) > 0 {
+		name := args[0]
+		t, ok := b.Tasks[name]
+		if !ok {
+			return nil, fmt.Errorf("No Such Task: %s", name)
+		}
+
+		flags := t.Flags
+		if flags == nil {
+			flags = flag.NewFlagSet(name, flag.ContinueOnError)
+		}
+		err := flags.Parse(args[1:])
+		if err != nil {
+			return nil, fmt.Errorf("Task %s: %s", name, err)
+		}
+		args = flags.Args()
+		tasks = append(tasks, name)
+	}
+	return tasks, nil
+}
+
 // Run setups a build and runs the listed tasks.
 func Run(client func(b *Build)) {
-	//log.Flags = *level
-
 	b := NewBuild()
 	client(b)
 
+	if err := b.Validate(); err != nil {
+		for _, err := range err.(GraphError) {
+			b.Error(err)
+		}
+		os.Exit(1)
+	}
+
 	interrupts := make(chan os.Signal, 1)
 	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
 
+	// Set once the build is interrupted, it then exits with 130.
+	var interrupted int32
+
 	go func() {
 		sig := <-interrupts
+		atomic.StoreInt32(&interrupted, 1)
 		// stop watches and clean up.
 		fmt.Println() //Next line
 		b.Warnf("Captured %v, stopping build and exiting...", sig)
 		b.Warn("Press ctrl+c again to force exit.")
-		ret := 0
-		select {
-		case err := <-b.Cancel():
-			if err != nil {
-				b.Error(err)
-				b.Error("Cleaning up anyways.")
-				b.Cleanup()
-				ret = 1
+		cancelled := b.Cancel()
+		for {
+			select {
+			case err := <-cancelled:
+				if err != nil {
+					b.Error(err)
+					b.Error("Cleaning up anyways.")
+					b.Cleanup()
+					os.Exit(1)
+				}
+				// The tasks are done, the build exits once it has
+				// cleaned up and written the report.
+				cancelled = nil
+			case <-interrupts:
+				fmt.Println() //Next line
+				b.Warn("Force exit.")
+				os.Exit(1)
 			}
-		case <-interrupts:
-			fmt.Println() //Next line
-			b.Warn("Force exit.")
-			ret = 1
 		}
-		os.Exit(ret)
-
 	}()
 
 	flag.Parse()
-	tasks := flag.Args()
+
+	if err := b.logger(); err != nil {
+		b.Fatal(err)
+	}
+
+	tasks, err := b.parse(flag.Args())
+	if err != nil {
+		b.Fatal(err)
+	}
 
 	if *help {
 		if len(tasks) == 0 {
-			HelpTemplate.ExecuteTemplate(os.Stdout, "build", b)
+			HelpTemplate.ExecuteTemplate(os.Stdout, "build", buildHelp{b, flagUsages(flag.CommandLine)})
 			return
 		}
 
 		for _, t := range tasks {
-			if t, ok := b.Tasks[t]; ok {
-				HelpTemplate.ExecuteTemplate(os.Stdout, "task", t)
-				continue
-			}
-			b.Fatalf("No Such Task: %s", t)
+			t := b.Tasks[t]
+			HelpTemplate.ExecuteTemplate(os.Stdout, "task", taskHelp{t, flagUsages(t.Flags)})
 		}
 
 		return
 	}
 
+	if *graph {
+		b.Dot(os.Stdout)
+		return
+	}
+
 	if len(tasks) == 0 {
 		tasks = []string{"default"}
 	}
 
+	if *tree {
+		for _, t := range tasks {
+			b.Tree(os.Stdout, t)
+		}
+		return
+	}
+
+	if *watch {
+		if err := b.watch(tasks...); err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup()
+		if atomic.LoadInt32(&interrupted) == 1 {
+			os.Exit(130)
+		}
+		return
+	}
+
+	if *dryrun {
+		b.DryRun = true
+		b.Notice("Dry run, the tasks would run in this order:")
+		for i, level := range b.levels(tasks...) {
+			b.Infof("%d: %s", i+1, strings.Join(level, ", "))
+		}
+	}
+
+	b.KeepGoing = *keepgoing
+
 	b.Infof("Running: %s", strings.Join(tasks, ","))
-	b.Start(b.C, tasks...).Wait()
+	r := newRun(b, b.C)
+	b.Start(r.c, tasks...).Wait()
+	r.cancel()
+	if b.group != nil {
+		b.group.FlushAll()
+	}
+	if b.live != nil {
+		b.live.Stop()
+	}
 	b.Cleanup()
+
+	if *reportfile != "" {
+		err := r.report.write(*reportfile)
+		if err != nil {
+			b.Error(err)
+		}
+	}
+
+	failed := r.report.failed()
+	if len(failed) > 0 {
+		b.Errorf("Failed tasks (%d):", len(failed))
+		for _, rep := range failed {
+			b.Errorf("  %s: %s", rep.Name, rep.Error)
+		}
+	}
+
+	switch {
+	case atomic.LoadInt32(&interrupted) == 1:
+		os.Exit(130)
+	case len(failed) > 0:
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+)
+
+// The version of the slurp runner, it is part of the cache key so
+// that upgrading slurp invalidates the cached builds.
+const version = "0.2.0"
+
+// cacheDir returns the directory slurp caches the compiled builds in.
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "slurp"), nil
+}
+
+// cachePath returns the path of the cached build binary for the
+// current directory. The path changes whenever the sources of the build
+// or the local packages it imports, the go.mod/go.sum of the module, the
+// go toolchain or slurp itself change.
+func cachePath() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	key, err := cacheKey(cwd)
+	if err != nil {
+		return "", err
+	}
+
+	name := "slurp-" + filepath.Base(cwd)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(dir, hash(cwd), key, name), nil
+}
+
+// pruneCache removes the earlier cached builds of the same directory
+// as the build binary.
+func pruneCache(bin string) error {
+	key := filepath.Dir(bin)
+	entries, err := filepath.Glob(filepath.Join(filepath.Dir(key), "*"))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry == key {
+			continue
+		}
+		err := os.RemoveAll(entry)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+func cacheKey(cwd string) (string, error) {
+	h := sha256.New()
+
+	env, err := exec.Command("go", "env", "GOVERSION", "GOOS", "GOARCH", "GOFLAGS").Output()
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintln(h, version, cwd, *bare, *slurpfile)
+	h.Write(env)
+
+	root, err := findModule(cwd)
+	if err != nil {
+		return "", err
+	}
+
+	files, err := sources(cwd, root != "")
+	if err != nil {
+		return "", err
+	}
+	if root != "" {
+		files = append(files, filepath.Join(root, "go.mod"), filepath.Join(root, "go.sum"))
+	}
+
+	sort.Strings(files)
+	for _, file := range files {
+		err := hashFile(h, file)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sources lists the source files of the build and of all the packages
+// it imports that can change without a change to go.mod or go.sum, that
+// is, the packages of the main module and of the replace directories,
+// or everything outside of the standard library without modules.
+func sources(cwd string, modules bool) ([]string, error) {
+	pkg := "."
+	if *bare {
+		pkg = *slurpfile
+	}
+
+	cmd := exec.Command("go", "list", "-e", "-deps", "-tags=slurp", "-json", pkg)
+	cmd.Dir = cwd
+	if !modules {
+		cmd.Env = append(os.Environ(), "GO111MODULE=off")
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var p struct {
+			Dir        string
+			Standard   bool
+			GoFiles    []string
+			CgoFiles   []string
+			EmbedFiles []string
+			Module     *struct {
+				Main    bool
+				Replace *struct{ Version string }
+			}
+		}
+		err := dec.Decode(&p)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if p.Standard {
+			continue
+		}
+		if m := p.Module; m != nil && !m.Main && (m.Replace == nil || m.Replace.Version != "") {
+			continue
+		}
+
+		for _, names := range [][]string{p.GoFiles, p.CgoFiles, p.EmbedFiles} {
+			for _, name := range names {
+				if !filepath.IsAbs(name) {
+					name = filepath.Join(p.Dir, name)
+				}
+				files = append(files, name)
+			}
+		}
+	}
+	return files, nil
+}
+
+func hashFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fmt.Fprintln(w, path)
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// cleanCache removes all the cached builds.
+func cleanCache() error {
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	log.Printf("Removing %s", dir)
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var gopaths = strings.Split(os.Getenv("GOPATH"), string(os.PathListSeparator))
+
+func runnerpath(path string) string {
+	return filepath.Join(path, "slurp-"+filepath.Base(path))
+}
+
+// generateGopath generates the runner under $GOPATH/src/slurp/IMPORT/PATH
+// for packages outside of a Go module.
+func generateGopath(cwd string) (*runner, error) {
+
+	if len(gopaths) == 0 || gopaths[0] == "" {
+		return nil, errors.New("$GOPATH must be set outside of a Go module.")
+	}
+
+	// find the correct gopath
+	var gopathsrc string
+	var pkgpath string
+	var err error
+	for _, gopath := range gopaths {
+		gopathsrcTest := filepath.Join(gopath, "src")
+		// the target package import path.
+		pkgpath, err = filepath.Rel(gopathsrcTest, cwd)
+		if err != nil {
+			return nil, err
+		}
+		if base := filepath.Base(pkgpath); base == "." || base == ".." {
+			continue // cwd is outside this gopath
+		}
+		gopathsrc = gopathsrcTest
+		break
+	}
+
+	if gopathsrc == "" {
+		return nil, errors.New("forbidden path. Your CWD must be under $GOPATH/src or a Go module.")
+	}
+
+	//build our package path.
+	path := filepath.Join(gopathsrc, "slurp", pkgpath)
+
+	r := &runner{
+		path: path,
+		pkg:  filepath.ToSlash(runnerpath(filepath.Join("slurp", pkgpath))),
+		env:  []string{"GO111MODULE=off", "GO15VENDOREXPERIMENT=1"},
+	}
+	r.get = []string{"get", "-tags=slurp", "-v", r.pkg}
+
+	//Clean it up.
+	os.RemoveAll(path)
+
+	//log.Println("Creating temporary build path...", path)
+	//Create the runner package directory.
+	err = os.MkdirAll(path, 0700)
+	if err != nil {
+		return r, err
+	}
+
+	//TODO, copy [*.go !_test.go] files into tmp first,
+	// this would allow slurp to work for broken packages
+	// with "-bare" as the package files will be excluded.
+	fset := token.NewFileSet() // positions are relative to fset
+
+	//log.Printf("Parsing %s...", pkgpath)
+	pkg, err := parse(fset, cwd)
+	if err != nil {
+		return r, err
+	}
+
+	if pkg.Name == "main" {
+
+		for file, f := range pkg.Files {
+			name, err := filepath.Rel(cwd, file)
+			if err != nil {
+				//Should never get error. But just incase.
+				return r, err
+			}
+			err = copyMain(fset, f, file, filepath.Join(path, name))
+			if err != nil {
+				return r, err
+			}
+		}
+
+		pkgpath = filepath.Join("slurp", pkgpath)
+	}
+
+	if info, err := os.Stat("vendor"); err == nil && info.IsDir() {
+		if err := filepath.Walk("vendor", func(p string, info os.FileInfo, _ error) error {
+			if info.IsDir() {
+				return os.Mkdir(filepath.Join(path, p), 0700)
+			}
+			if !strings.HasSuffix(p, ".go") || strings.HasSuffix(p, "_test.go") {
+				return nil
+			}
+			srcfile, dstfile, err := copyFile(p, filepath.Join(path, p))
+			if err != nil {
+				return err
+			}
+			srcfile.Close()
+			dstfile.Close()
+			return nil
+		}); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	//log.Println("Generating the runner...")
+	runner := runnerpath(path)
+	err = os.Mkdir(runner, 0700)
+	if err != nil {
+		return r, err
+	}
+
+	return r, writeRunner(filepath.Join(runner, "main.go"), filepath.ToSlash(pkgpath))
+}
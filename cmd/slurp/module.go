@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The directory, relative to the slurp package, that the runner
+// packages are overlaid at. It never exists on disk.
+const overlayDir = "_slurp"
+
+// findModule returns the root directory of the Go module that dir
+// belongs to, or an empty string if it is not in a module.
+func findModule(dir string) (string, error) {
+	if os.Getenv("GO111MODULE") == "off" {
+		return "", nil
+	}
+	for {
+		info, err := os.Stat(filepath.Join(dir, "go.mod"))
+		if err == nil && !info.IsDir() {
+			return dir, nil
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// modulePath reads the module path from a go.mod file.
+func modulePath(gomod string) (string, error) {
+	file, err := os.Open(gomod)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		if p, err := strconv.Unquote(fields[1]); err == nil {
+			return p, nil
+		}
+		return fields[1], nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("No module path found in " + gomod)
+}
+
+// generateModule generates the runner in a temporary directory and
+// overlays it onto the module with the go tool -overlay flag, so the
+// runner is built as part of the module and the module's replace
+// directives and vendor directory are honored.
+func generateModule(cwd, root string) (*runner, error) {
+
+	modpath, err := modulePath(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := filepath.Rel(root, cwd)
+	if err != nil {
+		return nil, err
+	}
+	pkgpath := path.Join(modpath, filepath.ToSlash(rel))
+
+	tmp, err := ioutil.TempDir("", "slurp-")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &runner{path: tmp}
+	r.get = []string{"mod", "download"}
+
+	overlay := make(map[string]string)
+
+	fset := token.NewFileSet()
+	pkg, err := parse(fset, cwd)
+	if err != nil {
+		return r, err
+	}
+
+	if pkg.Name == "main" {
+		client := filepath.Join(tmp, "client")
+		err := os.Mkdir(client, 0700)
+		if err != nil {
+			return r, err
+		}
+
+		for file, f := range pkg.Files {
+			name := filepath.Base(file)
+			err := copyMain(fset, f, file, filepath.Join(client, name))
+			if err != nil {
+				return r, err
+			}
+			overlay[filepath.Join(cwd, overlayDir, "client", name)] = filepath.Join(client, name)
+		}
+		pkgpath = path.Join(pkgpath, overlayDir, "client")
+	}
+
+	name := "slurp-" + filepath.Base(cwd)
+	src := filepath.Join(tmp, "main.go")
+	err = writeRunner(src, pkgpath)
+	if err != nil {
+		return r, err
+	}
+	overlay[filepath.Join(cwd, overlayDir, name, "main.go")] = src
+
+	r.pkg = path.Join(modpath, filepath.ToSlash(rel), overlayDir, name)
+
+	raw, err := json.Marshal(struct{ Replace map[string]string }{overlay})
+	if err != nil {
+		return r, err
+	}
+
+	overlayfile := filepath.Join(tmp, "overlay.json")
+	err = ioutil.WriteFile(overlayfile, raw, 0600)
+	if err != nil {
+		return r, err
+	}
+
+	r.flags = []string{"-overlay=" + overlayfile}
+	return r, nil
+}
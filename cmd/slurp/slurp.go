@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
@@ -18,15 +19,13 @@ import (
 )
 
 var (
-	gopaths = strings.Split(os.Getenv("GOPATH"), string(os.PathListSeparator))
-	cwd     string
-
 	flags     = flag.NewFlagSet("slurp", flag.ContinueOnError)
 	build     = flags.Bool("build", false, "build the current build as slurp-bin")
 	install   = flags.Bool("install", false, "install current slurp.Go as slurp.PKG.")
 	bare      = flags.Bool("bare", false, "Run/Install the slurp.go file without any other files.")
 	slurpfile = flags.String("slurpfile", "slurp.go", "The file that includes the Slurp(*s.Build) function, use by -bare")
-	keep      = flags.Bool("keep", false, "keep the generated source under $GOPATH/src/slurp/IMPORT/PATH")
+	keep      = flags.Bool("keep", false, "keep the generated runner source.")
+	rebuild   = flags.Bool("rebuild", false, "rebuild the build even if a cached binary is up to date.")
 )
 
 func init() {
@@ -39,238 +38,291 @@ func init() {
 
 func main() {
 
-	flags.Parse(os.Args[1:])
-
-	if len(gopaths) == 0 || gopaths[0] == "" {
-		log.Fatal("$GOPATH must be set.")
-	}
-
 	err := run()
+	if exit, ok := err.(*exec.ExitError); ok {
+		// The build, or the go tool, has reported its own errors, just
+		// pass on its status.
+		code := exit.ExitCode()
+		if code < 0 {
+			code = 1 // Killed by a signal.
+		}
+		os.Exit(code)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
-func runnerpath(path string) string {
-	return filepath.Join(path, "slurp-"+filepath.Base(path))
+// runner is a generated runner package and how to build it.
+type runner struct {
+	// The generated sources.
+	path string
+	// The import path of the runner package.
+	pkg string
+	// Extra flags and environment for the go tool.
+	flags []string
+	env   []string
+	// The go tool arguments to fetch the dependencies of the runner.
+	get []string
+}
+
+func (r *runner) command(args ...string) *exec.Cmd {
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(os.Environ(), r.env...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// tool returns a go tool command with the runner build flags.
+func (r *runner) tool(name string, args ...string) *exec.Cmd {
+	args = append(append([]string{name, "-tags=slurp"}, r.flags...), args...)
+	return r.command(args...)
+}
+
+func generate() (*runner, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := findModule(cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	if root != "" {
+		return generateModule(cwd, root)
+	}
+	return generateGopath(cwd)
 }
 
 func run() error {
-	path, pkgpath, err := generate()
+	params, err := buildArgs(os.Args[1:])
 	if err != nil {
 		return err
 	}
 
-	//Don't forget to clean up.
-	if !*keep {
-		defer os.RemoveAll(path)
+	if len(params) > 1 && params[0] == "cache" && params[1] == "clean" {
+		return cleanCache()
 	}
 
-	get := exec.Command("go", "get", "-tags=slurp", "-v")
-	get.Dir = path
-	get.Stdin = os.Stdin
-	get.Stdout = os.Stdout
-	get.Stderr = os.Stderr
+	initialize := len(params) > 0 && params[0] == "init"
 
-	if *build || *install {
-		err := get.Run()
+	// The cached binary of the build, when running.
+	var bin string
+
+	if !*build && !*install {
+		var err error
+		bin, err = cachePath()
 		if err != nil {
 			return err
 		}
-	}
 
-	var args []string
+		if _, err := os.Stat(bin); err == nil && !*rebuild && !initialize {
+			return execute(bin, params)
+		}
+	}
 
-	path = runnerpath(path)
+	r, err := generate()
+	if r != nil && !*keep {
+		//Don't forget to clean up.
+		defer os.RemoveAll(r.path)
+	}
+	if err != nil {
+		return err
+	}
 
-	if *build {
-		args = []string{"build", "-tags=slurp", "-o=slurp-bin", runnerpath(pkgpath)}
-	} else if *install {
-		args = []string{"install", "-tags=slurp", runnerpath(pkgpath)}
-	} else {
-		params := os.Args[1:]
+	if *keep {
+		log.Printf("Keeping the generated runner at %s", r.path)
+	}
 
-		if len(params) > 0 && params[0] == "init" {
-			err := get.Run()
-			if err != nil {
-				return err
-			}
+	if *build || *install || initialize {
+		err := r.command(r.get...).Run()
+		if err != nil {
+			return err
 		}
+	}
 
-		args = []string{"run", "-tags=slurp", filepath.Join(path, "main.go")}
-		args = append(args, params...)
+	if *build {
+		return r.tool("build", "-o=slurp-bin", r.pkg).Run()
 	}
 
-	cmd := exec.Command("go", args...)
-	cmd.Env = append(os.Environ(), "GO15VENDOREXPERIMENT=1")
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	if *install {
+		return r.tool("install", r.pkg).Run()
+	}
 
-	if !*build && !*install {
-		interrupts := make(chan os.Signal, 1)
-		signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	err = os.MkdirAll(filepath.Dir(bin), 0700)
+	if err != nil {
+		return err
+	}
 
-		go func() {
-			for sig := range interrupts {
-				cmd.Process.Signal(sig)
-			}
-		}()
+	// Build next to the cache entry and move it in place once done so
+	// a concurrent or interrupted build never leaves a broken binary.
+	tmp := fmt.Sprintf("%s.%d", bin, os.Getpid())
+	err = r.tool("build", "-o="+tmp, r.pkg).Run()
+	if err != nil {
+		os.Remove(tmp)
+		return err
 	}
-	err = cmd.Run()
 
+	err = os.Rename(tmp, bin)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	err = pruneCache(bin)
+	if err != nil {
+		log.Printf("Failed to remove the old builds: %s", err)
+	}
+
+	return execute(bin, params)
 }
 
-func generate() (string, string, error) {
+// execute runs the build binary and forwards interrupts to it.
+func execute(bin string, params []string) error {
+	cmd := exec.Command(bin, params...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
 
-	cwd, err := os.Getwd()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+
+	err := cmd.Start()
 	if err != nil {
-		return "", "", err
+		return err
 	}
 
-	// find the correct gopath
-	var gopathsrc string
-	var pkgpath string
-	for _, gopath := range gopaths {
-		gopathsrcTest := filepath.Join(gopath, "src")
-		// the target package import path.
-		pkgpath, err = filepath.Rel(gopathsrcTest, cwd)
-		if err != nil {
-			return "", "", err
+	go func() {
+		for sig := range interrupts {
+			cmd.Process.Signal(sig)
 		}
-		if base := filepath.Base(pkgpath); base == "." || base == ".." {
-			continue // cwd is outside this gopath
+	}()
+
+	return cmd.Wait()
+}
+
+// buildArgs sets the runner's own flags and returns the rest of the
+// arguments, which are passed to the build. The runner and build flags
+// can be mixed in any order, but just like flag parsing, the runner
+// flags are only looked for before the first task name or "--".
+// The value of a build flag must be given as -flag=value.
+func buildArgs(args []string) ([]string, error) {
+	var params []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := strings.TrimLeft(arg, "-")
+		if name == arg || name == "" {
+			return append(params, args[i:]...), nil
 		}
-		gopathsrc = gopathsrcTest
-		break
-	}
 
-	if gopathsrc == "" {
-		return "", pkgpath, errors.New("forbidden path. Your CWD must be under $GOPATH/src.")
-	}
+		var value string
+		hasValue := false
+		if j := strings.Index(name, "="); j >= 0 {
+			name, value, hasValue = name[:j], name[j+1:], true
+		}
 
-	//build our package path.
-	path := filepath.Join(gopathsrc, "slurp", pkgpath)
+		f := flags.Lookup(name)
+		if f == nil {
+			params = append(params, arg)
+			continue
+		}
 
-	//Clean it up.
-	os.RemoveAll(path)
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			if !hasValue {
+				value = "true"
+			}
+		} else if !hasValue {
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("flag needs an argument: -%s", name)
+			}
+			i++
+			value = args[i]
+		}
 
-	//log.Println("Creating temporary build path...", path)
-	//Create the runner package directory.
-	err = os.MkdirAll(path, 0700)
-	if err != nil {
-		return path, pkgpath, err
+		err := flags.Set(name, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for flag -%s: %s", value, name, err)
+		}
 	}
+	return params, nil
+}
 
-	//TODO, copy [*.go !_test.go] files into tmp first,
-	// this would allow slurp to work for broken packages
-	// with "-bare" as the package files will be excluded.
-	fset := token.NewFileSet() // positions are relative to fset
-
+// parse parses the package clause of the slurp package in dir, or just
+// the slurpfile with -bare.
+func parse(fset *token.FileSet, dir string) (*ast.Package, error) {
 	var pkgs map[string]*ast.Package
 
-	//log.Printf("Parsing %s...", pkgpath)
-
 	if *bare {
 		pkgs = make(map[string]*ast.Package)
-		src, err := parser.ParseFile(fset, *slurpfile, nil, parser.PackageClauseOnly)
+		src, err := parser.ParseFile(fset, filepath.Join(dir, *slurpfile), nil, parser.PackageClauseOnly)
 		if err != nil {
-			return path, pkgpath, err
+			return nil, err
 		}
 		pkgs[src.Name.Name] = &ast.Package{
 			Name:  src.Name.Name,
-			Files: map[string]*ast.File{filepath.Join(cwd, *slurpfile): src},
+			Files: map[string]*ast.File{filepath.Join(dir, *slurpfile): src},
 		}
 	} else {
-		pkgs, err = parser.ParseDir(fset, cwd, nil, parser.PackageClauseOnly)
+		var err error
+		pkgs, err = parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+			return !strings.HasSuffix(fi.Name(), "_test.go")
+		}, parser.PackageClauseOnly)
 		if err != nil {
-			return path, pkgpath, err
+			return nil, err
 		}
 	}
 
 	if len(pkgs) > 1 {
-		return path, pkgpath, errors.New("Error: Multiple packages detected.")
+		return nil, errors.New("Error: Multiple packages detected.")
 	}
 
-	main, ok := pkgs["main"]
-
-	if ok {
-
-		for file, f := range main.Files {
-			name, err := filepath.Rel(cwd, file)
-			if err != nil {
-				//Should never get error. But just incase.
-				return path, pkgpath, err
-			}
-			srcfile, dstfile, err := copyFile(file, filepath.Join(path, name))
-			if err != nil {
-				return path, pkgpath, err
-			}
-			defer dstfile.Close()
-			defer srcfile.Close()
-
-			pos := fset.Position(f.Name.NamePos)
-
-			_, err = dstfile.Seek(int64(pos.Offset), 0)
-			if err != nil {
-				return path, pkgpath, err
-			}
-
-			_, err = dstfile.Write([]byte(`niam`))
-			if err != nil {
-				return path, pkgpath, err
-			}
-		}
-
-		pkgpath = filepath.Join("slurp", pkgpath)
+	for _, pkg := range pkgs {
+		return pkg, nil
 	}
+	return nil, errors.New("Error: No Go files found.")
+}
 
-	if info, err := os.Stat("vendor"); err == nil && info.IsDir() {
-		if err := filepath.Walk("vendor", func(p string, info os.FileInfo, _ error) error {
-			if info.IsDir() {
-				return os.Mkdir(filepath.Join(path, p), 0700)
-			}
-			if !strings.HasSuffix(p, ".go") || strings.HasSuffix(p, "_test.go") {
-				return nil
-			}
-			srcfile, dstfile, err := copyFile(p, filepath.Join(path, p))
-			if err != nil {
-				return err
-			}
-			srcfile.Close()
-			dstfile.Close()
-			return nil
-		}); err != nil {
-			log.Fatal(err)
-		}
+// copyMain copies a file of a main package to dst and renames the
+// package so that it can be imported by the runner.
+func copyMain(fset *token.FileSet, f *ast.File, src, dst string) error {
+	srcfile, dstfile, err := copyFile(src, dst)
+	if dstfile != nil {
+		defer dstfile.Close()
+		defer srcfile.Close()
 	}
-
-	//log.Println("Generating the runner...")
-	runner := runnerpath(path)
-	err = os.Mkdir(runner, 0700)
 	if err != nil {
-		return path, pkgpath, err
+		return err
 	}
 
-	file, err := os.Create(filepath.Join(runner, "main.go"))
+	pos := fset.Position(f.Name.NamePos)
+
+	_, err = dstfile.Seek(int64(pos.Offset), 0)
 	if err != nil {
-		return path, pkgpath, err
+		return err
 	}
 
-	//tmp = filepath.Join(tmp, "tmp")
+	_, err = dstfile.Write([]byte(`niam`))
+	return err
+}
+
+// writeRunner generates the runner main package importing pkg.
+func writeRunner(path string, pkg string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
 
-	err = runnerSrc.Execute(file, filepath.ToSlash(pkgpath))
+	err = runnerSrc.Execute(file, pkg)
 	if err != nil {
-		return path, pkgpath, err
+		file.Close()
+		return err
 	}
 
-	err = file.Close()
-	return path, pkgpath, err
+	return file.Close()
 }
 
 // copyFile is a helper method for copying a file to another location.
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestBuildArgs(t *testing.T) {
+	for _, tc := range []struct {
+		args    []string
+		params  []string
+		rebuild bool
+		keep    bool
+		file    string
+	}{
+		{
+			args:   []string{"default"},
+			params: []string{"default"},
+			file:   "slurp.go",
+		},
+		{
+			args:    []string{"-rebuild", "-k", "-n", "-keep", "build"},
+			params:  []string{"-k", "-n", "build"},
+			rebuild: true,
+			keep:    true,
+			file:    "slurp.go",
+		},
+		{
+			args:    []string{"-v", "-slurpfile", "build.go", "-tree", "--rebuild=true", "deploy", "-keep"},
+			params:  []string{"-v", "-tree", "deploy", "-keep"},
+			rebuild: true,
+			file:    "build.go",
+		},
+		{
+			args:   []string{"-j=4", "-slurpfile=x.go", "--", "-keep"},
+			params: []string{"-j=4", "--", "-keep"},
+			file:   "x.go",
+		},
+	} {
+		flags.VisitAll(func(f *flag.Flag) { f.Value.Set(f.DefValue) })
+
+		params, err := buildArgs(tc.args)
+		if err != nil {
+			t.Fatalf("%v: %s", tc.args, err)
+		}
+		if !reflect.DeepEqual(params, tc.params) {
+			t.Errorf("%v: got params %q, want %q", tc.args, params, tc.params)
+		}
+		if *rebuild != tc.rebuild || *keep != tc.keep || *slurpfile != tc.file {
+			t.Errorf("%v: got rebuild=%v keep=%v slurpfile=%s", tc.args, *rebuild, *keep, *slurpfile)
+		}
+	}
+
+	flags.VisitAll(func(f *flag.Flag) { f.Value.Set(f.DefValue) })
+	if _, err := buildArgs([]string{"-rebuild=maybe"}); err == nil {
+		t.Error("expected an error for an invalid runner flag value")
+	}
+}
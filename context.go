@@ -1,22 +1,93 @@
 package slurp
 
-
 import (
-  "github.com/omeid/slurp/log"
+	"context"
+	"flag"
+
+	"github.com/omeid/slurp/log"
 )
 
+// C is the context passed to tasks and stages.
+// It implements context.Context, its Done channel is closed when the
+// current build is canceled and you should return as soon as possible.
 type C struct {
+	context.Context
 	log.Log
-	done <-chan struct{}
+
+	// The flags of the running task.
+	flags *flag.FlagSet
+
+	dryrun bool
+
+	// The build invocation this context belongs to, nil outside of a run.
+	run *run
+	// The report of the running task.
+	report *taskReport
+}
+
+// New returns a copy of c that adds the key value pairs to the fields
+// of its log messages, the task sets "task" and stages set "stage".
+// The fields are dropped if the Log is not a log.Fielder. With a single
+// argument, it is added as a prefix to the messages instead.
+//
+//	c = c.New("stage", "fs.Dest")
+func (c *C) New(keyvals ...string) *C {
+	l := c.Log
+	switch f, ok := l.(log.Fielder); {
+	case len(keyvals) == 1:
+		l = l.New(keyvals[0])
+	case len(keyvals)%2 != 0:
+		panic("slurp: odd number of key values passed to C.New")
+	case ok:
+		l = f.With(keyvals...)
+	}
+	return &C{Context: c.Context, Log: l, flags: c.flags, dryrun: c.dryrun, run: c.run, report: c.report}
+}
+
+// Debug logs a debug message, if the Log is a log.Debugger.
+func (c *C) Debug(v ...interface{}) {
+	if d, ok := c.Log.(log.Debugger); ok {
+		d.Debug(v...)
+	}
+}
+
+// Debugf is like Debug but formats the message like fmt.Sprintf.
+func (c *C) Debugf(format string, v ...interface{}) {
+	if d, ok := c.Log.(log.Debugger); ok {
+		d.Debugf(format, v...)
+	}
+}
+
+// WithContext returns a copy of c that uses ctx, which should be
+// derived from c, for its deadline, cancellation and values.
+//
+//	ctx, cancel := context.WithTimeout(c, time.Minute)
+//	defer cancel()
+//	err := web.Get(c.WithContext(ctx), url).Then(...)
+func (c *C) WithContext(ctx context.Context) *C {
+	return &C{Context: ctx, Log: c.Log, flags: c.flags, dryrun: c.dryrun, run: c.run, report: c.report}
 }
 
-func (c *C) New(prefix string) *C {
-  return &C{Log: c.Log.New(prefix), done: c.done}
+// DryRun reports whether the build is a dry run, started with -n.
+// Only the actions of the tasks that set Task.DryRun are called in a
+// dry run, stages that fetch, write or execute anything should only log
+// what they would do, and so should those actions.
+func (c *C) DryRun() bool {
+	return c.dryrun
 }
 
-// Done returns a channel that's closed when the current build is
-// canceled. You should return as soon as possible.
-// Successive calls to Done return the same value.
-func (c  *C) Done() <-chan struct{} {
-  return c.done
+// Flag returns the value of the named command-line flag of the
+// running task, or nil if the task has no such flag.
+//
+//	env := c.Flag("env").Get().(string)
+func (c *C) Flag(name string) flag.Getter {
+	if c.flags == nil {
+		return nil
+	}
+	f := c.flags.Lookup(name)
+	if f == nil {
+		return nil
+	}
+	getter, _ := f.Value.(flag.Getter)
+	return getter
 }
@@ -33,6 +33,8 @@ func Slurp(b *slurp.Build) {
 			Deps: []string{"a", "b", "c"},
 			Action: func(c *slurp.C) error {
 
+				// a, b and c have already run as dependencies of this
+				// task, so these calls just wait for their results.
 				b.Warn("Calling locally.")
 				b.Run(c, "a", "b", "c")
 				b.Warn("Calling One by one.")
@@ -3,6 +3,7 @@ package slurp
 import (
 	"io"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -15,6 +16,22 @@ type File struct {
 	Path string //Full path.
 
 	FileInfo FileInfo
+
+	err error
+	// The file count of the task the file belongs to, see C.Track.
+	files *int64
+}
+
+// ErrorFile returns a File that carries err down the pipe in place of
+// any content. Stages never see it, it is passed to the end of the pipe
+// and returned by Pipe.Wait.
+func ErrorFile(err error) File {
+	return File{err: err}
+}
+
+// Err returns the error carried by the file, if it is an ErrorFile.
+func (f File) Err() error {
+	return f.err
 }
 
 // Returns a copy of File.FileInfo.
@@ -29,6 +46,16 @@ func (f File) Stat() (os.FileInfo, error) {
   return f.FileInfo, nil
 }
 
+// Rel returns the path of the file relative to its Dir, which is where
+// it goes under a destination, see fs.Dest.
+func (f File) Rel() string {
+	rel, err := filepath.Rel(f.Dir, f.Path)
+	if err != nil {
+		return f.Path
+	}
+	return rel
+}
+
 func (f *File) Close() error {
 	return Close(f.Reader)
 }
@@ -0,0 +1,213 @@
+package slurp
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GraphError lists all the problems found in the task graph.
+type GraphError []error
+
+func (e GraphError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate resolves the dependencies of all the registered tasks and
+// checks the graph for missing tasks and circular dependencies.
+// It reports every problem at once as a GraphError.
+// Tasks can be registered in any order, the graph is validated before
+// running any task, so you usually don't need to call it yourself.
+func (b *Build) Validate() error {
+	b.graph.Lock()
+	defer b.graph.Unlock()
+	return b.validate()
+}
+
+func (b *Build) validate() error {
+	if b.order != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(b.Tasks))
+	for name := range b.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs GraphError
+
+	deps := make(map[string][]*task, len(names))
+	for _, name := range names {
+		t := b.Tasks[name]
+		for _, dep := range t.Deps {
+			d, ok := b.Tasks[dep]
+			if !ok {
+				errs = append(errs, fmt.Errorf("Missing Task %s. Required by Task %s.", dep, name))
+				continue
+			}
+			deps[name] = append(deps[name], d)
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	var (
+		state = make(map[string]int)
+		stack []string
+		order []*task
+		visit func(t *task)
+	)
+
+	visit = func(t *task) {
+		switch state[t.Name] {
+		case visited:
+			return
+		case visiting:
+			for i, name := range stack {
+				if name == t.Name {
+					path := append(append([]string{}, stack[i:]...), t.Name)
+					errs = append(errs, fmt.Errorf("Circular dependency: %s", strings.Join(path, " -> ")))
+					break
+				}
+			}
+			return
+		}
+
+		state[t.Name] = visiting
+		stack = append(stack, t.Name)
+		for _, d := range deps[t.Name] {
+			visit(d)
+		}
+		stack = stack[:len(stack)-1]
+		state[t.Name] = visited
+		order = append(order, t)
+	}
+
+	for _, name := range names {
+		visit(b.Tasks[name])
+	}
+
+	if errs != nil {
+		return errs
+	}
+
+	b.order = order
+	b.deps = deps
+	return nil
+}
+
+// dependencies returns the resolved dependencies of the task.
+func (b *Build) dependencies(t *task) []*task {
+	b.graph.Lock()
+	defer b.graph.Unlock()
+	return b.deps[t.Name]
+}
+
+// levels returns the tasks and all of their dependencies grouped by
+// their depth in the graph, the tasks in each level only depend on the
+// tasks of the previous levels and so they can run in parallel.
+// The graph must be valid.
+func (b *Build) levels(tasks ...string) [][]string {
+	b.graph.Lock()
+	defer b.graph.Unlock()
+
+	depth := make(map[string]int)
+
+	var visit func(t *task) int
+	visit = func(t *task) int {
+		if d, ok := depth[t.Name]; ok {
+			return d
+		}
+		d := 0
+		for _, dep := range b.deps[t.Name] {
+			if n := visit(dep) + 1; n > d {
+				d = n
+			}
+		}
+		depth[t.Name] = d
+		return d
+	}
+
+	for _, name := range tasks {
+		if t, ok := b.Tasks[name]; ok {
+			visit(t)
+		}
+	}
+
+	var levels [][]string
+	for name, d := range depth {
+		for len(levels) <= d {
+			levels = append(levels, nil)
+		}
+		levels[d] = append(levels[d], name)
+	}
+	for _, level := range levels {
+		sort.Strings(level)
+	}
+	return levels
+}
+
+// Dot writes the graph of all the tasks and their dependencies as a
+// Graphviz DOT document, the edges point from tasks to their deps.
+func (b *Build) Dot(w io.Writer) error {
+	names := make([]string, 0, len(b.Tasks))
+	for name := range b.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := []string{"digraph slurp {"}
+	for _, name := range names {
+		t := b.Tasks[name]
+		lines = append(lines, fmt.Sprintf("\t%s [tooltip=%s];", strconv.Quote(name), strconv.Quote(t.Usage)))
+		for _, dep := range t.Deps {
+			lines = append(lines, fmt.Sprintf("\t%s -> %s;", strconv.Quote(name), strconv.Quote(dep)))
+		}
+	}
+	lines = append(lines, "}")
+
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// Tree writes the dependency tree of the task in plain text.
+//
+//	default
+//	|-- css
+//	|   `-- deps
+//	`-- js
+//	    `-- deps
+func (b *Build) Tree(w io.Writer, name string) error {
+	lines := []string{name}
+
+	var walk func(name, indent string)
+	walk = func(name, indent string) {
+		t, ok := b.Tasks[name]
+		if !ok {
+			return
+		}
+		for i, dep := range t.Deps {
+			branch, next := "|-- ", "|   "
+			if i == len(t.Deps)-1 {
+				branch, next = "`-- ", "    "
+			}
+			lines = append(lines, indent+branch+dep)
+			walk(dep, indent+next)
+		}
+	}
+	walk(name, "")
+
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
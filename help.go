@@ -1,7 +1,9 @@
 package slurp
 
 import (
-  "text/template"
+	"flag"
+	"fmt"
+	"text/template"
 )
 
 // The text template for the build help topic.
@@ -49,6 +51,41 @@ OPTIONS:
 var HelpTemplate *template.Template
 
 func init() {
-  HelpTemplate = template.Must(template.New("build").Parse(BuildHelpTemplate))
-  HelpTemplate = template.Must(HelpTemplate.New("task").Parse(TaskHelpTemplate))
+	HelpTemplate = template.Must(template.New("build").Parse(BuildHelpTemplate))
+	HelpTemplate = template.Must(HelpTemplate.New("task").Parse(TaskHelpTemplate))
+}
+
+// The data passed to the build help template.
+type buildHelp struct {
+	*Build
+	Flags []string
+}
+
+// The data passed to the task help template.
+type taskHelp struct {
+	*task
+	Flags []string
+}
+
+// flagUsages returns one line of usage per flag in the set.
+func flagUsages(flags *flag.FlagSet) []string {
+	var usages []string
+	if flags == nil {
+		return usages
+	}
+	flags.VisitAll(func(f *flag.Flag) {
+		name, usage := flag.UnquoteUsage(f)
+		name = "-" + f.Name + " " + name
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" {
+			def := f.DefValue
+			if getter, ok := f.Value.(flag.Getter); ok {
+				if _, ok := getter.Get().(string); ok {
+					def = fmt.Sprintf("%q", def)
+				}
+			}
+			usage = fmt.Sprintf("%s (default %s)", usage, def)
+		}
+		usages = append(usages, fmt.Sprintf("%-15s %s", name, usage))
+	})
+	return usages
 }
@@ -0,0 +1,215 @@
+package slurp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/omeid/slurp/tools/glob"
+)
+
+// StateDir is where slurp keeps the state of incremental tasks,
+// relative to the working directory.
+var StateDir = ".slurp"
+
+// state is the on-disk record of the last successful run of the
+// incremental tasks.
+type state struct {
+	lock   sync.Mutex
+	loaded bool
+
+	Tasks map[string]taskState `json:"tasks"`
+}
+
+type taskState struct {
+	// The content hash of the inputs of the last successful run.
+	Inputs string `json:"inputs"`
+}
+
+func (s *state) path() string {
+	return filepath.Join(StateDir, "state.json")
+}
+
+func (s *state) load() error {
+	if s.loaded {
+		return nil
+	}
+	s.loaded = true
+	s.Tasks = make(map[string]taskState)
+
+	raw, err := ioutil.ReadFile(s.path())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, s)
+}
+
+func (s *state) get(name string) (taskState, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.load()
+	return s.Tasks[name], err
+}
+
+func (s *state) set(name string, ts taskState) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.load()
+	if err != nil {
+		return err
+	}
+	s.Tasks[name] = ts
+
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(StateDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path() + ".tmp"
+	err = ioutil.WriteFile(tmp, raw, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path())
+}
+
+// incremental reports whether the task declares its inputs.
+func (t *task) incremental() bool {
+	return len(t.Inputs) > 0
+}
+
+// uptodate reports whether the task can be skipped, that is, it has run
+// successfully before, and all of its outputs exist and are newer than
+// its inputs, or its inputs haven't changed since the last successful
+// run. A task whose inputs match no files is never up to date. It also
+// returns the hash of the inputs to record once the task succeeds.
+func (t *task) uptodate(s *state) (bool, string, error) {
+	inputs, err := match(t.Inputs)
+	if err != nil {
+		return false, "", err
+	}
+
+	hash, newest, err := hashFiles(inputs)
+	if err != nil || len(inputs) == 0 {
+		return false, hash, err
+	}
+
+	last, err := s.get(t.Name)
+	if err != nil || last.Inputs == "" {
+		return false, hash, err
+	}
+
+	if len(t.Outputs) > 0 {
+		var outputs []string
+		for _, output := range t.Outputs {
+			files, err := match([]string{output})
+			if err != nil {
+				return false, hash, err
+			}
+			if len(files) == 0 {
+				return false, hash, nil
+			}
+			outputs = append(outputs, files...)
+		}
+
+		oldest, err := oldest(outputs)
+		if err != nil {
+			return false, hash, err
+		}
+		if newest.Before(oldest) {
+			return true, hash, nil
+		}
+	}
+
+	return last.Inputs == hash, hash, nil
+}
+
+// match returns the sorted list of files matching the globs, including
+// the files under the matching directories.
+func match(globs []string) ([]string, error) {
+	matches, err := glob.Glob(globs...)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for m := range matches {
+		info, err := os.Stat(m.Name)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			files = append(files, m.Name)
+			continue
+		}
+		err = filepath.Walk(m.Name, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				files = append(files, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// hashFiles returns the hash of the names and content of the files and
+// the modification time of the newest one.
+func hashFiles(files []string) (string, time.Time, error) {
+	var newest time.Time
+
+	h := sha256.New()
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return "", newest, err
+		}
+		info, err := f.Stat()
+		if err == nil {
+			if info.ModTime().After(newest) {
+				newest = info.ModTime()
+			}
+			fmt.Fprintf(h, "%s %d\n", name, info.Size())
+			_, err = io.Copy(h, f)
+		}
+		f.Close()
+		if err != nil {
+			return "", newest, err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), newest, nil
+}
+
+// oldest returns the modification time of the oldest file.
+func oldest(files []string) (time.Time, error) {
+	var oldest time.Time
+	for _, name := range files {
+		info, err := os.Stat(name)
+		if err != nil {
+			return oldest, err
+		}
+		if oldest.IsZero() || info.ModTime().Before(oldest) {
+			oldest = info.ModTime()
+		}
+	}
+	return oldest, nil
+}
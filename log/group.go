@@ -0,0 +1,109 @@
+package log
+
+import (
+	"os"
+	"sync"
+)
+
+// Group is a Sink that holds back the messages of every task, by
+// their "task" field, and writes them as one block when the task is
+// flushed, so the output of parallel tasks doesn't interleave.
+// Messages without a task go straight through.
+//
+// If live is set, the messages of one task, the focused task, are
+// written as they come. The focus moves to the oldest waiting task once
+// the focused task is flushed.
+type Group struct {
+	sink Sink
+	live bool
+
+	lock  sync.Mutex
+	focus string
+	tasks []string // The tasks with held messages, oldest first.
+	held  map[string][]Entry
+}
+
+// NewGroup returns a Group that writes to the sink.
+func NewGroup(sink Sink, live bool) *Group {
+	return &Group{sink: sink, live: live, held: make(map[string][]Entry)}
+}
+
+func (g *Group) Write(e Entry) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if e.Level == LevelFatal {
+		// The program is about to exit.
+		g.flushAll()
+		g.sink.Write(e)
+		return
+	}
+
+	task := e.field("task")
+	if task == "" {
+		g.sink.Write(e)
+		return
+	}
+
+	if g.live && g.focus == "" {
+		g.focus = task
+	}
+	if task == g.focus {
+		g.sink.Write(e)
+		return
+	}
+
+	if _, ok := g.held[task]; !ok {
+		g.tasks = append(g.tasks, task)
+	}
+	g.held[task] = append(g.held[task], e)
+}
+
+// Flush writes the held messages of the task.
+func (g *Group) Flush(task string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.flush(task)
+
+	if task != g.focus {
+		return
+	}
+	g.focus = ""
+	if g.live && len(g.tasks) > 0 {
+		g.focus = g.tasks[0]
+		g.flush(g.focus)
+	}
+}
+
+// FlushAll writes the held messages of all the tasks.
+func (g *Group) FlushAll() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.flushAll()
+}
+
+func (g *Group) flushAll() {
+	for len(g.tasks) > 0 {
+		g.flush(g.tasks[0])
+	}
+}
+
+func (g *Group) flush(task string) {
+	for _, e := range g.held[task] {
+		g.sink.Write(e)
+	}
+	delete(g.held, task)
+	for i, t := range g.tasks {
+		if t == task {
+			g.tasks = append(g.tasks[:i], g.tasks[i+1:]...)
+			break
+		}
+	}
+}
+
+// IsTerminal reports whether the file is a terminal.
+func IsTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,165 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Live draws the progress bars and counters at the bottom of a
+// terminal and redraws them in place as they advance. The messages
+// must be written through its Sink so they don't break the bars.
+type Live struct {
+	w io.Writer
+
+	lock  sync.Mutex
+	bars  []*bar
+	drawn int // The number of lines drawn.
+	limit *ratelimit
+}
+
+// NewLive returns a Live that draws on w, which should be a terminal.
+func NewLive(w io.Writer) *Live {
+	return &Live{w: w, limit: NewRateLimit(Rate / 3)}
+}
+
+// width returns the width of the terminal, it is read on every draw so
+// the bars follow the resizes. If w is not a terminal, or its size is
+// unknown, $COLUMNS is used, and failing that, 80.
+func (lv *Live) width() int {
+	if f, ok := lv.w.(*os.File); ok {
+		if width := termWidth(f); width > 0 {
+			return width
+		}
+	}
+	width, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil || width < 20 {
+		width = 80
+	}
+	return width
+}
+
+// Sink returns a Sink that clears the bars, writes the message to the
+// sink, which must write to the same terminal, and draws them again.
+func (lv *Live) Sink(sink Sink) Sink {
+	return SinkFunc(func(e Entry) {
+		lv.lock.Lock()
+		defer lv.lock.Unlock()
+		lv.clear()
+		sink.Write(e)
+		lv.draw()
+	})
+}
+
+// Stop removes all the bars.
+func (lv *Live) Stop() {
+	lv.lock.Lock()
+	defer lv.lock.Unlock()
+	lv.clear()
+	lv.bars = nil
+}
+
+type bar struct {
+	name  string
+	size  int64
+	done  int64
+	last  string
+	bytes bool
+	start time.Time
+}
+
+func (lv *Live) add(name string, size int64, bytes bool) *bar {
+	b := &bar{name: name, size: size, bytes: bytes, start: time.Now()}
+	lv.lock.Lock()
+	lv.bars = append(lv.bars, b)
+	lv.lock.Unlock()
+	return b
+}
+
+func (lv *Live) set(b *bar, done int64, last string) {
+	lv.lock.Lock()
+	defer lv.lock.Unlock()
+	b.done = done
+	b.last = last
+	if !lv.limit.Limit() {
+		lv.clear()
+		lv.draw()
+	}
+}
+
+func (lv *Live) remove(b *bar) {
+	lv.lock.Lock()
+	defer lv.lock.Unlock()
+	for i, bb := range lv.bars {
+		if bb == b {
+			lv.bars = append(lv.bars[:i], lv.bars[i+1:]...)
+			break
+		}
+	}
+	lv.clear()
+	lv.draw()
+}
+
+// clear moves the cursor up to the first bar and clears the screen
+// from there.
+func (lv *Live) clear() {
+	if lv.drawn > 0 {
+		fmt.Fprintf(lv.w, "\x1b[%dA\x1b[J", lv.drawn)
+		lv.drawn = 0
+	}
+}
+
+func (lv *Live) draw() {
+	width := lv.width()
+	for _, b := range lv.bars {
+		line := []rune(" " + b.String())
+		if len(line) >= width {
+			line = line[:width-1]
+		}
+		fmt.Fprintln(lv.w, string(line))
+	}
+	lv.drawn = len(lv.bars)
+}
+
+func (b *bar) String() string {
+	elapsed := time.Since(b.start).Seconds()
+
+	count := func(n int64) string {
+		if b.bytes {
+			return humanize.Bytes(uint64(n))
+		}
+		return strconv.FormatInt(n, 10)
+	}
+
+	if b.size <= 0 {
+		return fmt.Sprintf("%s [UKN%%] %s %s", b.name, count(b.done), b.last)
+	}
+
+	percent := b.done * 100 / b.size
+	const width = 20
+	fill := int(percent) * width / 100
+	graph := make([]rune, width)
+	for i := range graph {
+		graph[i] = ' '
+		if i < fill {
+			graph[i] = '='
+		}
+	}
+
+	var speed, eta string
+	if elapsed > 0 && b.done > 0 {
+		rate := float64(b.done) / elapsed
+		if b.bytes {
+			speed = " " + humanize.Bytes(uint64(rate)) + "/s"
+		}
+		left := time.Duration(float64(b.size-b.done)/rate) * time.Second
+		eta = " ETA " + left.Round(time.Second).String()
+	}
+
+	return fmt.Sprintf("%s [%s] %3d%% %s of %s%s%s %s", b.name, string(graph), percent, count(b.done), count(b.size), speed, eta, b.last)
+}
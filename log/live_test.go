@@ -0,0 +1,31 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLive(t *testing.T) {
+	out := new(bytes.Buffer)
+	lv := NewLive(out)
+	l := NewLogger(lv.Sink(SinkFunc(func(e Entry) { out.WriteString(e.Message + "\n") })), lv)
+
+	c := l.Counter("unzipping", 4)
+	c.Set(1, "a")
+	if !strings.Contains(out.String(), "unzipping [=====               ]  25% 1 of 4") {
+		t.Fatalf("Expected the counter to be drawn. Got %q", out.String())
+	}
+
+	out.Reset()
+	l.Info("hello")
+	if !strings.HasPrefix(out.String(), "\x1b[1A\x1b[Jhello\n unzipping") {
+		t.Fatalf("Expected the counter to be redrawn under the message. Got %q", out.String())
+	}
+
+	out.Reset()
+	c.Set(4, "d")
+	if s := out.String(); !strings.HasSuffix(s, "unzipping [100%] 4 of 4 d\n") || strings.Contains(s, "=") {
+		t.Fatalf("Expected the counter to be removed and logged. Got %q", s)
+	}
+}
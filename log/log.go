@@ -3,11 +3,8 @@ package log
 import (
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"time"
-
-	"github.com/fatih/color"
 )
 
 var Rate = time.Millisecond * 300
@@ -34,30 +31,74 @@ type Log interface {
 	New(string) Log
 }
 
+// Debugger is implemented by the Logs that support debug messages.
+type Debugger interface {
+	Debug(v ...interface{})
+	Debugf(format string, v ...interface{})
+}
+
+// Fielder is implemented by the Logs that support fields.
+type Fielder interface {
+	// With returns a Log that adds the key value pairs to the fields
+	// of every message, e.g. With("task", "css", "stage", "fs.Dest").
+	With(keyvals ...string) Log
+}
+
+// The flags of the text sink, see the standard log package.
 var Flags int
 
+// New returns the default Log, it writes the messages from Info up
+// to the stdout as text.
 func New() Log {
-	l := log.New(os.Stdout, " ", Flags)
-	return &logger{l, ""}
+	return NewLogger(Filter(LevelInfo, Text(os.Stdout, true)), nil)
 }
 
-type Printer interface {
-	Printf(string, ...interface{})
+// NewLogger returns a Log that writes to the sink. If live is not nil,
+// the progress of reads and counters is drawn by it, otherwise it is
+// logged as Info every now and then. It is also a Debugger and a Fielder.
+func NewLogger(sink Sink, live *Live) Log {
+	return &logger{sink: sink, live: live}
 }
 
 type logger struct {
-	printer Printer
+	sink   Sink
+	live   *Live
 	prefix string
+	fields []Field
 }
 
+// New returns a Log that adds the prefix to every message.
 func (l *logger) New(prefix string) Log {
-	return &logger{l.printer, l.prefix + prefix}
+	return &logger{l.sink, l.live, l.prefix + prefix, l.fields}
+}
+
+func (l *logger) With(keyvals ...string) Log {
+	fields := make([]Field, len(l.fields), len(l.fields)+len(keyvals)/2+1)
+	copy(fields, l.fields)
+	for i := 0; i < len(keyvals); i += 2 {
+		f := Field{Key: keyvals[i]}
+		if i+1 < len(keyvals) {
+			f.Value = keyvals[i+1]
+		}
+		fields = append(fields, f)
+	}
+	return &logger{l.sink, l.live, l.prefix, fields}
+}
+
+func (l *logger) log(level Level, v ...interface{}) {
+	l.sink.Write(Entry{Time: time.Now(), Level: level, Message: l.prefix + fmt.Sprint(v...), Fields: l.fields})
 }
 
-var bold = color.New(color.Bold).SprintfFunc()
+func (l *logger) Debug(v ...interface{}) {
+	l.log(LevelDebug, v...)
+}
+
+func (l *logger) Debugf(format string, v ...interface{}) {
+	l.Debug(fmt.Sprintf(format, v...))
+}
 
 func (l *logger) Notice(v ...interface{}) {
-	l.printer.Printf(bold("[NOTE] %s%s ", l.prefix, fmt.Sprint(v...)))
+	l.log(LevelNotice, v...)
 }
 
 func (l *logger) Noticef(format string, v ...interface{}) {
@@ -65,7 +106,7 @@ func (l *logger) Noticef(format string, v ...interface{}) {
 }
 
 func (l *logger) Info(v ...interface{}) {
-	l.printer.Printf("[INFO] %s%s ", l.prefix, fmt.Sprint(v...))
+	l.log(LevelInfo, v...)
 }
 
 func (l *logger) Infof(format string, v ...interface{}) {
@@ -73,7 +114,7 @@ func (l *logger) Infof(format string, v ...interface{}) {
 }
 
 func (l *logger) Warn(v ...interface{}) {
-	l.printer.Printf(color.YellowString("[WARN] %s%s ", l.prefix, fmt.Sprint(v...)))
+	l.log(LevelWarn, v...)
 }
 
 func (l *logger) Warnf(format string, v ...interface{}) {
@@ -81,7 +122,7 @@ func (l *logger) Warnf(format string, v ...interface{}) {
 }
 
 func (l *logger) Error(v ...interface{}) {
-	l.printer.Printf(color.RedString("[ERR!] %s%s ", l.prefix, fmt.Sprint(v...)))
+	l.log(LevelError, v...)
 }
 
 func (l *logger) Errorf(format string, v ...interface{}) {
@@ -89,7 +130,7 @@ func (l *logger) Errorf(format string, v ...interface{}) {
 }
 
 func (l *logger) Fatal(v ...interface{}) {
-	l.printer.Printf(color.RedString("[FATAL] %s%s ", l.prefix, fmt.Sprint(v...)))
+	l.log(LevelFatal, v...)
 	os.Exit(1)
 }
 
@@ -13,13 +13,25 @@ func (l *logger) ReadProgress(r io.Reader, name string, size int64) io.ReadClose
 	if size > 0 {
 		sizeHuman = humanize.Bytes(uint64(size))
 	}
-	return &ProgressBar{r, name, size, 0, l, sizeHuman, 0, NewRateLimit(Rate)}
+	p := &ProgressBar{Reader: r, name: name, size: size, l: l, sizeHuman: sizeHuman, limit: NewRateLimit(Rate)}
+	if l.live != nil {
+		p.live = l.live
+		p.bar = l.live.add(name, size, true)
+	}
+	return p
 }
 
 func (l *logger) Counter(name string, size int) *Counter {
-	return &Counter{name, size, 0, "", l, NewRateLimit(Rate / 2)}
+	c := &Counter{name: name, size: size, l: l, limit: NewRateLimit(Rate / 2)}
+	if l.live != nil {
+		c.live = l.live
+		c.bar = l.live.add(name, int64(size), false)
+	}
+	return c
 }
 
+// ProgressBar reports the progress of a read, it is drawn live on a
+// terminal and logged every now and then otherwise.
 type ProgressBar struct {
 	io.Reader
 
@@ -33,6 +45,9 @@ type ProgressBar struct {
 	last      int64
 
 	limit *ratelimit
+
+	live *Live
+	bar  *bar
 }
 
 func (p *ProgressBar) print() {
@@ -47,6 +62,11 @@ func (p *ProgressBar) Read(b []byte) (int, error) {
 	n, err := p.Reader.Read(b)
 	p.done += int64(n)
 
+	if p.live != nil {
+		p.live.set(p.bar, p.done, "")
+		return n, err
+	}
+
 	if (p.done-p.last) > (p.size/50) && !p.limit.Limit() {
 		p.last = p.done
 		p.print()
@@ -56,6 +76,9 @@ func (p *ProgressBar) Read(b []byte) (int, error) {
 }
 
 func (p *ProgressBar) Close() error {
+	if p.live != nil {
+		p.live.remove(p.bar)
+	}
 	p.print()
 	c, ok := p.Reader.(io.Closer)
 	if ok {
@@ -64,6 +87,8 @@ func (p *ProgressBar) Close() error {
 	return nil
 }
 
+// Counter reports the progress of a countable job, it is drawn live
+// on a terminal and logged every now and then otherwise.
 type Counter struct {
 	name string
 	size int
@@ -73,11 +98,24 @@ type Counter struct {
 	l    Log
 
 	limit *ratelimit
+
+	live *Live
+	bar  *bar
 }
 
 func (c *Counter) Set(s int, last string) {
 	c.cur = s
 	c.last = last
+
+	if c.live != nil {
+		c.live.set(c.bar, int64(s), last)
+		if c.cur == c.size {
+			c.live.remove(c.bar)
+			c.print()
+		}
+		return
+	}
+
 	if !c.limit.Limit() || c.cur == c.size {
 		c.print()
 	}
@@ -0,0 +1,191 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Level is the severity of a message.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelNotice
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+var levels = [...]string{"debug", "info", "notice", "warn", "error", "fatal"}
+
+func (l Level) String() string {
+	if l < 0 || int(l) >= len(levels) {
+		return strconv.Itoa(int(l))
+	}
+	return levels[l]
+}
+
+// Field is a key value pair attached to a message.
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Entry is a single message.
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  []Field
+}
+
+// field returns the value of the field with the key, or "".
+func (e Entry) field(key string) string {
+	for _, f := range e.Fields {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Sink is where the messages of a Log go. It must be safe to call from
+// multiple goroutines.
+type Sink interface {
+	Write(Entry)
+}
+
+// SinkFunc is an adapter to use ordinary functions as a Sink.
+type SinkFunc func(Entry)
+
+func (f SinkFunc) Write(e Entry) {
+	f(e)
+}
+
+// Filter returns a Sink that drops the messages below the level.
+func Filter(level Level, sink Sink) Sink {
+	return SinkFunc(func(e Entry) {
+		if e.Level >= level {
+			sink.Write(e)
+		}
+	})
+}
+
+// Multi returns a Sink that writes every message to all of the sinks.
+func Multi(sinks ...Sink) Sink {
+	return SinkFunc(func(e Entry) {
+		for _, sink := range sinks {
+			sink.Write(e)
+		}
+	})
+}
+
+type Printer interface {
+	Printf(string, ...interface{})
+}
+
+var bold = color.New(color.Bold).SprintfFunc()
+
+var tags = [...]string{"[DBUG]", "[INFO]", "[NOTE]", "[WARN]", "[ERR!]", "[FATAL]"}
+
+// Text returns a Sink that writes the messages for humans, prefixed
+// with their level and task, using Flags. Only the task is shown of
+// the fields. Notices, warnings and errors are colored if colors is
+// set and the output supports it.
+func Text(w io.Writer, colors bool) Sink {
+	return &text{log.New(w, " ", Flags), colors}
+}
+
+type text struct {
+	printer Printer
+	colors  bool
+}
+
+func (t *text) Write(e Entry) {
+	tag := e.Level.String()
+	if e.Level >= 0 && int(e.Level) < len(tags) {
+		tag = tags[e.Level]
+	}
+	// The default task is not named, just like it always has been.
+	prefix := ""
+	if task := e.field("task"); task != "" && task != "default" {
+		prefix = task + ": "
+	}
+	line := fmt.Sprintf("%s %s%s ", tag, prefix, e.Message)
+
+	if t.colors {
+		switch {
+		case e.Level >= LevelError:
+			line = color.RedString("%s", line)
+		case e.Level == LevelWarn:
+			line = color.YellowString("%s", line)
+		case e.Level == LevelNotice:
+			line = bold("%s", line)
+		}
+	}
+	t.printer.Printf("%s", line)
+}
+
+// JSON returns a Sink that writes the messages as JSON objects, one
+// per line, with the time, level, msg, and the fields as keys.
+func JSON(w io.Writer) Sink {
+	return &structured{w: w, format: func(b *strings.Builder, key, value string) {
+		if b.Len() == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		v, _ := json.Marshal(value)
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}, end: "}\n"}
+}
+
+// Logfmt returns a Sink that writes the messages in logfmt, one per
+// line, with the time, level, msg, and the fields as keys.
+func Logfmt(w io.Writer) Sink {
+	return &structured{w: w, format: func(b *strings.Builder, key, value string) {
+		if b.Len() != 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		if value == "" || strings.ContainsAny(value, " =\"\t\r\n\\") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(value)
+	}, end: "\n"}
+}
+
+type structured struct {
+	lock   sync.Mutex
+	w      io.Writer
+	format func(b *strings.Builder, key, value string)
+	end    string
+}
+
+func (s *structured) Write(e Entry) {
+	var b strings.Builder
+	s.format(&b, "time", e.Time.Format(time.RFC3339Nano))
+	s.format(&b, "level", e.Level.String())
+	s.format(&b, "msg", e.Message)
+	for _, f := range e.Fields {
+		s.format(&b, f.Key, f.Value)
+	}
+	b.WriteString(s.end)
+
+	s.lock.Lock()
+	io.WriteString(s.w, b.String())
+	s.lock.Unlock()
+}
@@ -0,0 +1,85 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSinks(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, test := range []struct {
+		sink     func(*bytes.Buffer) Sink
+		expected string
+	}{
+		{func(b *bytes.Buffer) Sink { return JSON(b) }, `{"time":"2020-01-02T03:04:05Z","level":"warn","msg":"a \"b\"","task":"css","stage":"fs.Dest"}` + "\n"},
+		{func(b *bytes.Buffer) Sink { return Logfmt(b) }, `time=2020-01-02T03:04:05Z level=warn msg="a \"b\"" task=css stage=fs.Dest` + "\n"},
+	} {
+		b := new(bytes.Buffer)
+		l := &logger{sink: SinkFunc(func(e Entry) {
+			e.Time = now
+			test.sink(b).Write(e)
+		})}
+		l.With("task", "css").(Fielder).With("stage", "fs.Dest").Warn(`a "b"`)
+
+		if b.String() != test.expected {
+			t.Fatalf("Expected %s Got %s", test.expected, b.String())
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	var got []Level
+	l := NewLogger(Filter(LevelWarn, SinkFunc(func(e Entry) { got = append(got, e.Level) })), nil)
+
+	l.(Debugger).Debug("debug")
+	l.Info("info")
+	l.Notice("notice")
+	l.Warn("warn")
+	l.Error("error")
+
+	if len(got) != 2 || got[0] != LevelWarn || got[1] != LevelError {
+		t.Fatalf("Expected warn and error. Got %v", got)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	for _, live := range []bool{false, true} {
+		var got []string
+		g := NewGroup(SinkFunc(func(e Entry) { got = append(got, e.Message) }), live)
+		l := NewLogger(g, nil)
+		a, b := l.(Fielder).With("task", "a"), l.(Fielder).With("task", "b")
+
+		a.Info("a1")
+		b.Info("b1")
+		l.Info("build")
+		a.Info("a2")
+		b.Info("b2")
+		g.Flush("b")
+		g.Flush("a")
+
+		expected := "build b1 b2 a1 a2"
+		if live {
+			expected = "a1 build a2 b1 b2"
+		}
+		if s := strings.Join(got, " "); s != expected {
+			t.Fatalf("Expected %q with live %v. Got %q", expected, live, s)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	b := new(bytes.Buffer)
+	l := NewLogger(Text(b, false), nil)
+
+	l.(Fielder).With("task", "default").Info("a")
+	l.(Fielder).With("task", "css").Info("b")
+	l.New("js: ").Info("c")
+
+	expected := " [INFO] a \n [INFO] css: b \n [INFO] js: c \n"
+	if b.String() != expected {
+		t.Fatalf("Expected %q Got %q", expected, b.String())
+	}
+}
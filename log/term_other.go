@@ -0,0 +1,11 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package log
+
+import "os"
+
+// termWidth is not supported on this platform, it always returns 0.
+func termWidth(f *os.File) int {
+	return 0
+}
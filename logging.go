@@ -0,0 +1,78 @@
+package slurp
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/omeid/slurp/log"
+)
+
+var (
+	verbose    = flag.Bool("v", false, "verbose, also show the debug messages")
+	quiet      = flag.Bool("q", false, "quiet, only show the warnings and errors")
+	logformat  = flag.String("log-format", "text", "the format of the messages: text, json or logfmt")
+	noprogress = flag.Bool("no-progress", false, "don't draw the progress bars, log the progress every now and then instead")
+	group      = flag.Bool("group", false, "group the messages of each task and print them when the task is done, on a terminal one task is shown live")
+	logfile    = flag.String("log-file", "", "also write all the messages to the file, as JSON lines if it ends with .json, logfmt if it ends with .logfmt, and text otherwise")
+)
+
+// logger sets up the Log of the build from the command-line flags.
+func (b *Build) logger() error {
+	level := log.LevelInfo
+	switch {
+	case *quiet:
+		level = log.LevelWarn
+	case *verbose:
+		level = log.LevelDebug
+	}
+
+	terminal := *logformat == "text" && log.IsTerminal(os.Stdout)
+
+	var sink log.Sink
+	switch *logformat {
+	case "text":
+		sink = log.Text(os.Stdout, true)
+		// The progress is drawn live on terminals, unless asked not to
+		// or it wouldn't be shown anyways.
+		if terminal && !*noprogress && os.Getenv("NO_COLOR") == "" && level <= log.LevelInfo {
+			b.live = log.NewLive(os.Stdout)
+			sink = b.live.Sink(sink)
+		}
+	case "json":
+		sink = log.JSON(os.Stdout)
+	case "logfmt":
+		sink = log.Logfmt(os.Stdout)
+	default:
+		return fmt.Errorf("Unknown log format: %s", *logformat)
+	}
+	sink = log.Filter(level, sink)
+
+	if *group {
+		b.group = log.NewGroup(sink, terminal)
+		sink = b.group
+	}
+
+	if *logfile != "" {
+		file, err := os.OpenFile(*logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+
+		var filesink log.Sink
+		switch strings.ToLower(filepath.Ext(*logfile)) {
+		case ".json", ".jsonl":
+			filesink = log.JSON(file)
+		case ".logfmt":
+			filesink = log.Logfmt(file)
+		default:
+			filesink = log.Text(file, false)
+		}
+		sink = log.Multi(sink, filesink)
+	}
+
+	b.C.Log = log.NewLogger(sink, b.live)
+	return nil
+}
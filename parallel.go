@@ -0,0 +1,169 @@
+package slurp
+
+import (
+	"flag"
+	"runtime"
+	"sync"
+)
+
+var jobs = flag.Int("j", runtime.NumCPU(), "the maximum number of files processed in parallel across all stages")
+
+var (
+	limiter     chan struct{}
+	limiterOnce sync.Once
+)
+
+// limit returns the global limiter, it is created on first use so the
+// -j flag is parsed by then.
+func limit() chan struct{} {
+	limiterOnce.Do(func() {
+		n := *jobs
+		if n < 1 {
+			n = 1
+		}
+		limiter = make(chan struct{}, n)
+	})
+	return limiter
+}
+
+// Acquire takes one of the -j slots shared by all the Parallel stages,
+// it blocks until one is free, or fails if c is canceled first. The slot
+// must be freed with Release once the work is done.
+func Acquire(c *C) error {
+	select {
+	case limit() <- struct{}{}:
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
+
+// Release frees a slot taken by Acquire.
+func Release() {
+	<-limit()
+}
+
+// SlotHolder is implemented by the Readers that hold a slot taken by
+// Acquire until they are read to the end or closed, such as the output
+// of a running program. The Parallel stages process such files in the
+// slot they hold, instead of taking another one, since reading them is
+// part of the same work, and waiting for another slot may never end.
+type SlotHolder interface {
+	HoldsSlot() bool
+}
+
+// holdsSlot reports whether the file holds a slot, see SlotHolder.
+func holdsSlot(f File) bool {
+	h, ok := f.Reader.(SlotHolder)
+	return ok && h.HoldsSlot()
+}
+
+// Parallel returns a Stage that passes every file through fn on a pool
+// of n workers, n <= 0 means as many as the -j flag, which also caps the
+// number of files processed at once across all the Parallel stages.
+// The files are sent down the pipe as soon as they are done, so they may
+// come out in a different order, use ParallelOrdered to keep the order.
+//
+// If fn returns an error, it is sent down the pipe. If the returned file
+// has no Reader, nothing is sent, which is what a destination stage
+// wants. Just like any stage, fn must close the file if it doesn't pass
+// it on. The context passed to fn logs the path of the file as "file".
+func Parallel(c *C, n int, fn func(*C, File) (File, error)) Stage {
+	return parallel(c, n, false, fn)
+}
+
+// ParallelOrdered is like Parallel but sends the files down the pipe in
+// the same order they came in.
+func ParallelOrdered(c *C, n int, fn func(*C, File) (File, error)) Stage {
+	return parallel(c, n, true, fn)
+}
+
+func parallel(c *C, n int, ordered bool, fn func(*C, File) (File, error)) Stage {
+	if n <= 0 {
+		n = *jobs
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	process := func(f File) File {
+		if c.Err() != nil {
+			f.Close()
+			return File{}
+		}
+
+		held := holdsSlot(f)
+		if !held {
+			limit() <- struct{}{}
+		}
+		f, err := fn(c.New("file", f.Path), f)
+		if !held {
+			<-limit()
+		}
+
+		if err != nil {
+			return ErrorFile(err)
+		}
+		return f
+	}
+
+	send := func(out chan<- File, f File) {
+		if f.Reader != nil || f.err != nil {
+			out <- f
+		}
+	}
+
+	return func(in <-chan File, out chan<- File) {
+
+		type job struct {
+			file   File
+			result chan File
+		}
+
+		queue := make(chan job)
+		// The results of the jobs, in the order they came in.
+		results := make(chan chan File, n)
+
+		var wg sync.WaitGroup
+		wg.Add(n)
+		for i := 0; i < n; i++ {
+			go func() {
+				defer wg.Done()
+				for j := range queue {
+					f := process(j.file)
+					if ordered {
+						j.result <- f
+					} else {
+						send(out, f)
+					}
+				}
+			}()
+		}
+
+		sent := make(chan struct{})
+		go func() {
+			defer close(sent)
+			for result := range results {
+				send(out, <-result)
+			}
+		}()
+
+		for f := range in {
+			j := job{file: f}
+			if ordered {
+				j.result = make(chan File, 1)
+				results <- j.result
+			}
+			queue <- j
+		}
+
+		close(queue)
+		close(results)
+		wg.Wait()
+		<-sent
+
+		if err := c.Err(); err != nil {
+			out <- ErrorFile(err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package slurp
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParallelOrdered(t *testing.T) {
+	b := NewBuild()
+
+	var running, max int32
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+	var got []string
+	err := source(names...).Then(
+		ParallelOrdered(b.C, 3, func(c *C, f File) (File, error) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			// Finish the earlier files last.
+			time.Sleep(time.Duration(len(names)-int(f.Path[0]-'a')) * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return f, nil
+		}),
+		func(in <-chan File, out chan<- File) {
+			for f := range in {
+				got = append(got, f.Path)
+				out <- f
+			}
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if max > 3 {
+		t.Fatalf("Expected at most 3 workers. Got %d", max)
+	}
+	for i, name := range names {
+		if got[i] != name {
+			t.Fatalf("Expected %v. Got %v", names, got)
+		}
+	}
+}
+
+func TestParallelError(t *testing.T) {
+	b := NewBuild()
+	failed := errors.New("failed")
+
+	var passed int32
+	err := source("a", "b", "c").Then(
+		Parallel(b.C, 0, func(c *C, f File) (File, error) {
+			if f.Path == "b" {
+				f.Close()
+				return File{}, failed
+			}
+			if f.Path == "c" {
+				f.Close()
+				return File{}, nil
+			}
+			return f, nil
+		}),
+		func(in <-chan File, out chan<- File) {
+			for f := range in {
+				atomic.AddInt32(&passed, 1)
+				out <- f
+			}
+		},
+	)
+
+	if err != failed {
+		t.Fatalf("Expected %v. Got %v", failed, err)
+	}
+	if passed != 1 {
+		t.Fatalf("Expected only a to pass. Got %d files", passed)
+	}
+}
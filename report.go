@@ -0,0 +1,219 @@
+package slurp
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The status of a task in the build report.
+const (
+	statusOK        = "ok"
+	statusFailed    = "failed"
+	statusCancelled = "cancelled"
+	statusSkipped   = "skipped"
+)
+
+// taskReport is the record of a single task in a run.
+type taskReport struct {
+	Name     string    `json:"name"`
+	Deps     []string  `json:"deps"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration float64   `json:"duration"` // In seconds.
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Attempts int       `json:"attempts"`
+	Files    int64     `json:"files"`
+
+	// The functions to call if the task succeeds, see C.OnSuccess.
+	lock      sync.Mutex
+	onSuccess []func() error
+}
+
+func (rep *taskReport) finish(err error) {
+	rep.End = time.Now()
+	rep.Duration = rep.End.Sub(rep.Start).Seconds()
+	if err != nil {
+		rep.Error = err.Error()
+	}
+	if rep.Status != "" {
+		return
+	}
+	rep.Status = statusOK
+	if err != nil {
+		rep.Status = statusFailed
+	}
+}
+
+// report is the record of all the tasks started in a run.
+type report struct {
+	lock  sync.Mutex
+	tasks []*taskReport
+}
+
+func (r *report) add(t *task) *taskReport {
+	rep := &taskReport{Name: t.Name, Deps: t.Deps, Start: time.Now()}
+	if rep.Deps == nil {
+		rep.Deps = []string{}
+	}
+	r.lock.Lock()
+	r.tasks = append(r.tasks, rep)
+	r.lock.Unlock()
+	return rep
+}
+
+// failed returns the reports of the tasks that failed in the order
+// they were started.
+func (r *report) failed() []*taskReport {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var failed []*taskReport
+	for _, rep := range r.tasks {
+		if rep.Status == statusFailed {
+			failed = append(failed, rep)
+		}
+	}
+	sort.SliceStable(failed, func(i, j int) bool {
+		return failed[i].Start.Before(failed[j].Start)
+	})
+	return failed
+}
+
+// Track counts the file in the build report of the running task, as
+// one of the files that flowed through its pipelines. Source stages
+// should pass every file they produce through it, the new files that
+// the following stages make out of them are then counted by the pipe.
+func (c *C) Track(f File) File {
+	if c.report != nil && f.files == nil {
+		f.files = &c.report.Files
+		atomic.AddInt64(f.files, 1)
+	}
+	return f
+}
+
+// OnSuccess registers fn to be called once the running task succeeds,
+// an error from fn fails the task. Stages that keep state across runs
+// use it to only save their state once the whole task is done.
+// Outside of a task, fn is called right away.
+func (c *C) OnSuccess(fn func() error) {
+	if c.report == nil {
+		if err := fn(); err != nil {
+			c.Error(err)
+		}
+		return
+	}
+	c.report.lock.Lock()
+	c.report.onSuccess = append(c.report.onSuccess, fn)
+	c.report.lock.Unlock()
+}
+
+// reset forgets the functions registered by a failed attempt.
+func (rep *taskReport) reset() {
+	rep.lock.Lock()
+	rep.onSuccess = nil
+	rep.lock.Unlock()
+}
+
+// succeed calls the functions registered with C.OnSuccess.
+func (rep *taskReport) succeed() error {
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
+	for _, fn := range rep.onSuccess {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes the report to path as JUnit XML if the path ends with
+// .xml and as JSON otherwise.
+func (r *report) write(path string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	tasks := make([]*taskReport, len(r.tasks))
+	copy(tasks, r.tasks)
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].Start.Before(tasks[j].Start)
+	})
+
+	var (
+		raw []byte
+		err error
+	)
+	if strings.EqualFold(filepath.Ext(path), ".xml") {
+		raw, err = junit(tasks)
+	} else {
+		raw, err = json.MarshalIndent(struct {
+			Tasks []*taskReport `json:"tasks"`
+		}{tasks}, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, raw, 0644)
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Skipped   *junitMessage `xml:"skipped"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+func junit(tasks []*taskReport) ([]byte, error) {
+	var total float64
+	suite := junitSuite{Name: "slurp", Tests: len(tasks)}
+	for _, t := range tasks {
+		c := junitCase{Name: t.Name, ClassName: "slurp", Time: seconds(t.Duration)}
+		switch t.Status {
+		case statusFailed:
+			suite.Failures++
+			c.Failure = &junitMessage{t.Error}
+		case statusCancelled, statusSkipped:
+			suite.Skipped++
+			c.Skipped = &junitMessage{t.Status}
+			if t.Error != "" {
+				c.Skipped.Message += ": " + t.Error
+			}
+		}
+		total += t.Duration
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Time = seconds(total)
+
+	raw, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), raw...), nil
+}
+
+func seconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', 3, 64)
+}
@@ -1,29 +1,101 @@
 package slurp
 
 import (
+	"bytes"
 	"flag"
+	"io/ioutil"
 	"sync"
+	"sync/atomic"
 )
 
-var help = flag.Bool("help", false, "show help")
+var (
+	help       = flag.Bool("help", false, "show help")
+	watch      = flag.Bool("watch", false, "watch the inputs of the tasks and re-run them on changes")
+	reportfile = flag.String("report", "", "write a build report to the file, JUnit XML if it ends with .xml, JSON otherwise")
+	dryrun     = flag.Bool("n", false, "dry run, print the tasks in order without running them, only the tasks that support it log what their stages would do")
+	graph      = flag.Bool("graph", false, "print the graph of all the tasks in Graphviz DOT format")
+	tree       = flag.Bool("tree", false, "print the dependency tree of the tasks")
+	keepgoing  = flag.Bool("k", false, "keep going, run all the tasks that don't depend on a failed task")
+)
+
+func init() {
+	flag.BoolVar(keepgoing, "keep-going", false, "same as -k")
+}
 
 // A stage where a series of files goes for transformation, manipulation.
 // There is no correlation between a stages input and output, a stage may
 // decided to pass the same files after transofrmation or generate new files
 // based on the input.
+//
+// A stage reports failures by sending an ErrorFile down the pipe, such
+// files are never passed to the following stages, they go straight to
+// the end of the pipe and are returned by Wait.
 
 type Stage func(<-chan File, chan<- File)
 
 func (stage Stage) pipe(in <-chan File) Pipe {
 	out := make(chan File)
+	files := make(chan File)
+	staged := make(chan File)
+
+	// The file count of the task, taken from the incoming files, see
+	// C.Track. The files the stage makes are counted as they come out.
+	var count atomic.Value
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer close(files)
+		for f := range in {
+			if f.err != nil {
+				out <- f
+				continue
+			}
+			if f.files != nil && count.Load() == nil {
+				count.Store(f.files)
+			}
+			files <- f
+		}
+	}()
+
 	go func() {
-		stage(in, out)
+		defer wg.Done()
+		for f := range staged {
+			if n, ok := count.Load().(*int64); ok && f.err == nil && f.files == nil {
+				f.files = n
+				atomic.AddInt64(n, 1)
+			}
+			out <- f
+		}
+	}()
+
+	go func() {
+		stage(files, staged)
+		close(staged)
+		// Deliver or Destroy, close anything the stage left behind
+		// so the upstream doesn't block forever.
+		for f := range files {
+			f.Close()
+		}
+		wg.Wait()
 		close(out)
 	}()
 
 	return out
 }
 
+// Failable turns a stage function that can fail into a Stage.
+// If the function returns an error, it is sent down the pipe.
+func Failable(stage func(<-chan File, chan<- File) error) Stage {
+	return func(in <-chan File, out chan<- File) {
+		err := stage(in, out)
+		if err != nil {
+			out <- ErrorFile(err)
+		}
+	}
+}
+
 //Pipe is a channel of Files.
 type Pipe <-chan File
 
@@ -41,14 +113,25 @@ func (p Pipe) Pipe(stages ...Stage) Pipe {
 }
 
 // Waits for the end of channel and closes all the files.
+// It returns the first error sent down the pipe by any of the stages,
+// or failing that, the first error from closing the files.
 func (p Pipe) Wait() error {
-	var err error
+	var err, closeErr error
 	for f := range p {
+		if f.err != nil {
+			if err == nil {
+				err = f.err
+			}
+			continue
+		}
 		e := f.Close()
-		if err == nil && e != nil {
-			err = e
+		if closeErr == nil && e != nil {
+			closeErr = e
 		}
 	}
+	if err == nil {
+		err = closeErr
+	}
 	return err
 }
 
@@ -57,13 +140,92 @@ func (p Pipe) Then(stages ...Stage) error {
 	return p.Pipe(stages...).Wait()
 }
 
+// Tee duplicates every file of the pipe into n pipes, the content of
+// each file is read into memory so every pipe gets its own full copy.
+// The pipes must be consumed concurrently, typically by Merge:
+//
+//	pipes := fs.Src(c, "frontend/js/*.js").Tee(2)
+//	return slurp.Merge(
+//		pipes[0].Pipe(fs.Dest(c, "public/js")),
+//		pipes[1].Pipe(minify(c), fs.Dest(c, "public/js/min")),
+//	).Wait()
+//
+// Errors sent down the pipe are passed to all of the pipes.
+func (p Pipe) Tee(n int) []Pipe {
+	outs := make([]chan File, n)
+	pipes := make([]Pipe, n)
+	for i := range outs {
+		outs[i] = make(chan File)
+		pipes[i] = outs[i]
+	}
+
+	go func() {
+		defer func() {
+			for _, out := range outs {
+				close(out)
+			}
+		}()
+
+		for f := range p {
+			var content []byte
+			if f.err == nil {
+				var err error
+				content, err = ioutil.ReadAll(f)
+				f.Close()
+				if err != nil {
+					f = ErrorFile(err)
+				} else {
+					f.FileInfo.SetSize(int64(len(content)))
+				}
+			}
+
+			for _, out := range outs {
+				if f.err == nil {
+					f.Reader = bytes.NewReader(content)
+				}
+				out <- f
+			}
+		}
+	}()
+
+	return pipes
+}
+
+// Split routes the files of the pipe into two pipes, the files that
+// match pred go to the first pipe and the rest to the second one.
+// Just like Tee, the pipes must be consumed concurrently, and errors
+// sent down the pipe are passed to both.
+func (p Pipe) Split(pred func(File) bool) (Pipe, Pipe) {
+	matched := make(chan File)
+	rest := make(chan File)
+
+	go func() {
+		defer close(matched)
+		defer close(rest)
+
+		for f := range p {
+			switch {
+			case f.err != nil:
+				matched <- f
+				rest <- f
+			case pred(f):
+				matched <- f
+			default:
+				rest <- f
+			}
+		}
+	}()
+
+	return matched, rest
+}
+
 // Concurrently Merges the output of multiple chan of File into a pipe.
 func Merge(pipes ...<-chan File) Pipe {
 	out := make(chan File)
 
 	var wg sync.WaitGroup
+	wg.Add(len(pipes))
 	go func(out chan File) {
-		wg.Add(len(pipes))
 		for _, p := range pipes {
 			go func(in Pipe) {
 				for f := range in {
@@ -0,0 +1,103 @@
+package slurp
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func source(names ...string) Pipe {
+	out := make(chan File)
+	go func() {
+		defer close(out)
+		for _, name := range names {
+			out <- File{Reader: strings.NewReader(name), Path: name}
+		}
+	}()
+	return out
+}
+
+func TestPipeError(t *testing.T) {
+	failed := errors.New("stage failed")
+
+	var seen []string
+	err := source("a", "b", "c").Then(
+		Failable(func(in <-chan File, out chan<- File) error {
+			for f := range in {
+				if f.Path == "b" {
+					f.Close()
+					return failed
+				}
+				out <- f
+			}
+			return nil
+		}),
+		func(in <-chan File, out chan<- File) {
+			for f := range in {
+				if f.Err() != nil {
+					t.Fatal("Stage received an ErrorFile.")
+				}
+				seen = append(seen, f.Path)
+				out <- f
+			}
+		},
+	)
+
+	if err != failed {
+		t.Fatalf("Expected %v from Then. Got %v", failed, err)
+	}
+	if len(seen) != 1 || seen[0] != "a" {
+		t.Fatalf("Expected only a to pass. Got %v", seen)
+	}
+}
+
+func TestTee(t *testing.T) {
+	pipes := source("a", "b").Tee(2)
+
+	var contents [2][]string
+	read := func(i int) Stage {
+		return func(in <-chan File, out chan<- File) {
+			for f := range in {
+				content, _ := ioutil.ReadAll(f)
+				contents[i] = append(contents[i], string(content))
+				out <- f
+			}
+		}
+	}
+
+	err := Merge(pipes[0].Pipe(read(0)), pipes[1].Pipe(read(1))).Wait()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	for i, c := range contents {
+		if strings.Join(c, ",") != "a,b" {
+			t.Fatalf("Expected a,b in pipe %d. Got %v", i, c)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	matched, rest := source("a.js", "b.css", "c.js").Split(func(f File) bool {
+		return strings.HasSuffix(f.Path, ".js")
+	})
+
+	var js, css []string
+	collect := func(paths *[]string) Stage {
+		return func(in <-chan File, out chan<- File) {
+			for f := range in {
+				*paths = append(*paths, f.Path)
+				out <- f
+			}
+		}
+	}
+
+	err := Merge(matched.Pipe(collect(&js)), rest.Pipe(collect(&css))).Wait()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if strings.Join(js, ",") != "a.js,c.js" || strings.Join(css, ",") != "b.css" {
+		t.Fatalf("Expected [a.js c.js] [b.css]. Got %v %v", js, css)
+	}
+}
@@ -0,0 +1,208 @@
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/omeid/slurp"
+)
+
+// Option configures the archive stages.
+type Option func(*options)
+
+type options struct {
+	// Creation.
+	deterministic bool
+
+	// Extraction.
+	sanitize bool
+	strip    int
+	include  []string
+	exclude  []string
+	dirs     bool
+	symlinks bool
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Deterministic makes the created archives reproducible, the entries
+// are sorted by name and get the same modification time, see Epoch.
+func Deterministic() Option {
+	return func(o *options) {
+		o.deterministic = true
+	}
+}
+
+// Sanitize makes the extraction stages clean up the entries that would
+// end up outside of the destination, that is, absolute paths and paths
+// with too many "..", rather than failing. Symlinks that point outside
+// of the archive are skipped.
+func Sanitize() Option {
+	return func(o *options) {
+		o.sanitize = true
+	}
+}
+
+// Strip removes the first n components from the path of the extracted
+// entries, just like tar --strip-components, the entries that have no
+// more than n components are skipped.
+func Strip(n int) Option {
+	return func(o *options) {
+		o.strip = n
+	}
+}
+
+// Include only extracts the entries that match any of the globs, see
+// tools/glob. The globs are matched against the path of the entries,
+// after Strip, and their base name.
+func Include(globs ...string) Option {
+	return func(o *options) {
+		o.include = append(o.include, globs...)
+	}
+}
+
+// Exclude skips the entries that match any of the globs, just like
+// Include.
+func Exclude(globs ...string) Option {
+	return func(o *options) {
+		o.exclude = append(o.exclude, globs...)
+	}
+}
+
+// Dirs makes the extraction stages pass the directory entries down the
+// pipe, they are skipped otherwise.
+func Dirs() Option {
+	return func(o *options) {
+		o.dirs = true
+	}
+}
+
+// Symlinks makes the extraction stages pass the symlinks down the pipe
+// with the target as their content, they are skipped otherwise.
+func Symlinks() Option {
+	return func(o *options) {
+		o.symlinks = true
+	}
+}
+
+// Epoch is the modification time of the entries of deterministic
+// archives, the earliest time a zip file can hold.
+var Epoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// entry is a file that goes into an archive.
+type entry struct {
+	name    string
+	mode    os.FileMode
+	modTime time.Time
+	content []byte
+}
+
+func (e entry) dir() bool {
+	return e.mode.IsDir()
+}
+
+// newEntry reads the file as an entry named by its path relative to
+// its Dir, and closes it.
+func newEntry(f slurp.File, o options) (entry, error) {
+	defer f.Close()
+
+	e := entry{
+		name:    strings.TrimLeft(filepath.ToSlash(f.Rel()), "/"),
+		mode:    f.FileInfo.Mode(),
+		modTime: f.FileInfo.ModTime(),
+	}
+
+	if f.FileInfo.IsDir() {
+		e.mode |= os.ModeDir
+	} else {
+		var err error
+		e.content, err = ioutil.ReadAll(f)
+		if err != nil {
+			return e, err
+		}
+	}
+
+	if e.mode.Perm() == 0 {
+		e.mode |= 0644
+		if e.dir() {
+			e.mode |= 0755
+		}
+	}
+
+	switch {
+	case o.deterministic:
+		e.modTime = Epoch
+	case e.modTime.IsZero():
+		e.modTime = time.Now()
+	}
+	e.modTime = e.modTime.Truncate(time.Second)
+	return e, nil
+}
+
+// collect reads the files from in and calls add for every one of them,
+// in the order they come, or sorted by name for deterministic archives.
+func collect(c *slurp.C, in <-chan slurp.File, name string, o options, add func(entry) error) error {
+	var entries []entry
+	for f := range in {
+		if err := c.Err(); err != nil {
+			f.Close()
+			return err
+		}
+
+		e, err := newEntry(f, o)
+		if err != nil {
+			return err
+		}
+		if e.name == "" || e.name == "." {
+			continue
+		}
+		c.Debugf("Adding %s to %s", e.name, name)
+
+		if o.deterministic {
+			entries = append(entries, e)
+			continue
+		}
+		if err := add(e); err != nil {
+			return err
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+	for _, e := range entries {
+		if err := add(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archiveFile returns the archive as a File named name.
+func archiveFile(name string, content []byte, o options) slurp.File {
+	fi := slurp.FileInfo{}
+	fi.SetName(filepath.Base(name))
+	fi.SetSize(int64(len(content)))
+	fi.SetMode(0644)
+	fi.SetModTime(time.Now())
+	if o.deterministic {
+		fi.SetModTime(Epoch)
+	}
+
+	return slurp.File{
+		Reader:   bytes.NewReader(content),
+		Path:     name,
+		FileInfo: fi,
+	}
+}
@@ -0,0 +1,124 @@
+package archive
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omeid/slurp"
+)
+
+// testFile is a file that goes into or comes out of a pipe.
+type testFile struct {
+	path    string
+	mode    os.FileMode
+	content string
+}
+
+// src returns a pipe of the files.
+func src(files ...testFile) slurp.Pipe {
+	pipe := make(chan slurp.File, len(files))
+	for _, f := range files {
+		fi := slurp.FileInfo{}
+		fi.SetName(path.Base(f.path))
+		fi.SetMode(f.mode)
+		fi.SetSize(int64(len(f.content)))
+		fi.SetModTime(time.Now())
+		pipe <- slurp.File{Reader: strings.NewReader(f.content), Path: f.path, FileInfo: fi}
+	}
+	close(pipe)
+	return pipe
+}
+
+// drain reads all the files of the pipe.
+func drain(p slurp.Pipe) ([]testFile, []time.Time, error) {
+	var (
+		files []testFile
+		times []time.Time
+	)
+	err := p.Pipe(func(in <-chan slurp.File, out chan<- slurp.File) {
+		for f := range in {
+			content, err := ioutil.ReadAll(f)
+			f.Close()
+			if err != nil {
+				out <- slurp.ErrorFile(err)
+				continue
+			}
+			files = append(files, testFile{f.Path, f.FileInfo.Mode(), string(content)})
+			times = append(times, f.FileInfo.ModTime())
+		}
+	}).Wait()
+	return files, times, err
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := slurp.NewBuild().C
+
+	input := []testFile{
+		{"b.txt", 0644, "bee"},
+		{"a/x.sh", 0755, "echo x"},
+		{"a/link", os.ModeSymlink | 0777, "x.sh"},
+	}
+	expected := []testFile{input[2], input[1], input[0]}
+
+	for name, stage := range map[string]func() slurp.Stage{
+		"zip":    func() slurp.Stage { return Zip(c, "out.zip", Deterministic()) },
+		"tar.gz": func() slurp.Stage { return TarGz(c, "out.tar.gz", gzip.BestCompression, Deterministic()) },
+	} {
+		var archives []string
+		for i := 0; i < 2; i++ {
+			files, times, err := drain(src(input...).Pipe(stage()))
+			if err != nil || len(files) != 1 {
+				t.Fatalf("%s: Expected one archive. Got %v, %v", name, files, err)
+			}
+			if !times[0].Equal(Epoch) {
+				t.Fatalf("%s: Expected the archive at Epoch. Got %s", name, times[0])
+			}
+			archives = append(archives, files[0].content)
+		}
+		if archives[0] != archives[1] {
+			t.Fatalf("%s: Expected byte-identical archives.", name)
+		}
+
+		files, times, err := drain(src(testFile{"out", 0644, archives[0]}).Pipe(Extract(c, Symlinks())))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !reflect.DeepEqual(files, expected) {
+			t.Fatalf("%s: Expected %v. Got %v", name, expected, files)
+		}
+		for i, tm := range times {
+			if !tm.Equal(Epoch) {
+				t.Fatalf("%s: Expected %s at Epoch. Got %s", name, files[i].path, tm)
+			}
+		}
+	}
+}
+
+func TestArchiveDirs(t *testing.T) {
+	c := slurp.NewBuild().C
+
+	archive, _, err := drain(src(testFile{"d", os.ModeDir | 0755, ""}, testFile{"d/f", 0600, "f"}).Pipe(Tar(c, "out.tar")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range [][]Option{nil, {Dirs()}} {
+		files, _, err := drain(src(archive...).Pipe(Untar(c, opts...)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []testFile{{"d/f", 0600, "f"}}
+		if opts != nil {
+			expected = append([]testFile{{"d", os.ModeDir | 0755, ""}}, expected...)
+		}
+		if !reflect.DeepEqual(files, expected) {
+			t.Fatalf("Expected %v. Got %v", expected, files)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/omeid/slurp"
+	"github.com/omeid/slurp/tools/glob"
+)
+
+// The magic bytes of the supported formats.
+var (
+	zipMagic   = []byte("PK\x03\x04")
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	tarMagic   = []byte("ustar") // At tarMagicOffset.
+)
+
+const tarMagicOffset = 257
+
+// Extract extracts the zip, tar, tar.gz and tar.bz2 archives from the
+// input channel and passes their entries down the pipe, gzip and bzip2
+// files that are not tarballs are decompressed. The format is detected
+// from the content, not the name. xz is not supported.
+//
+// The archives are extracted one at a time, and the content of each
+// entry is read, into memory or a temporary file if it is large, before
+// it is passed on, so the following stages can hold on to the entries.
+//
+// Only the regular files are extracted by default, and the archive
+// fails if any entry would end up outside of the destination, see the
+// Options for the other choices. In a dry run, it only logs the archives.
+//
+// The entries are checked as they are extracted, so the entries before
+// an unsafe one are already passed on when the archive fails, and a
+// failed extraction may leave a partial tree behind in the destination.
+func Extract(c *slurp.C, opts ...Option) slurp.Stage {
+	c = c.New("stage", "archive.Extract")
+	o := newOptions(opts)
+	return each(c, func(file slurp.File, out chan<- slurp.File) error {
+		br := bufio.NewReader(file)
+
+		var r io.Reader
+		switch {
+		case peek(br, 0, zipMagic):
+			return unzip(c, file, br, out, o)
+		case peek(br, 0, gzipMagic):
+			gz, err := gzip.NewReader(br)
+			if err != nil {
+				return err
+			}
+			defer gz.Close()
+			r = gz
+		case peek(br, 0, bzip2Magic):
+			r = bzip2.NewReader(br)
+		case peek(br, 0, xzMagic):
+			return errors.New("xz archives are not supported.")
+		case peek(br, tarMagicOffset, tarMagic):
+			return untar(c, br, out, o)
+		default:
+			return errors.New("Unknown archive format.")
+		}
+
+		tr := bufio.NewReader(r)
+		if peek(tr, tarMagicOffset, tarMagic) {
+			return untar(c, tr, out, o)
+		}
+		return decompressed(c, file, tr, out)
+	})
+}
+
+// Gunzip decompresses the gzip files from the input channel and passes
+// them down the pipe without the .gz extension, .tgz becomes .tar.
+func Gunzip(c *slurp.C) slurp.Stage {
+	c = c.New("stage", "archive.Gunzip")
+	return each(c, func(file slurp.File, out chan<- slurp.File) error {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return decompressed(c, file, gz, out)
+	})
+}
+
+// decompressed sends the content of the compressed file down the pipe.
+func decompressed(c *slurp.C, file slurp.File, r io.Reader, out chan<- slurp.File) error {
+	path := file.Path
+	switch ext := filepath.Ext(path); strings.ToLower(ext) {
+	case ".gz", ".bz2":
+		path = strings.TrimSuffix(path, ext)
+	case ".tgz", ".tbz2":
+		path = strings.TrimSuffix(path, ext) + ".tar"
+	}
+
+	fi := file.FileInfo
+	fi.SetName(filepath.Base(path))
+
+	return send(c, out, slurp.File{Reader: r, Cwd: file.Cwd, Dir: file.Dir, Path: path, FileInfo: fi})
+}
+
+// each calls extract for every file from the input channel, one at a
+// time, and closes it. The errors are passed down the pipe. In a dry
+// run, the files are only logged, for all of the extraction stages.
+func each(c *slurp.C, fn func(slurp.File, chan<- slurp.File) error) slurp.Stage {
+	return func(in <-chan slurp.File, out chan<- slurp.File) {
+		for file := range in {
+			if err := c.Err(); err != nil {
+				file.Close()
+				out <- slurp.ErrorFile(err)
+				continue
+			}
+
+			if c.DryRun() {
+				c.Infof("Would extract %s", file.Path)
+				file.Close()
+				continue
+			}
+
+			err := fn(file, out)
+			file.Close()
+			if err != nil {
+				out <- slurp.ErrorFile(fmt.Errorf("%s: %s", file.Path, err))
+			}
+		}
+	}
+}
+
+// extract sends the entries returned by next down the pipe one at a
+// time, until it returns io.EOF. The entries are checked, renamed and
+// skipped as the options say.
+func extract(c *slurp.C, out chan<- slurp.File, o options, next func() (slurp.File, error)) error {
+	// The symlinks extracted so far.
+	links := make(map[string]bool)
+	for {
+		if err := c.Err(); err != nil {
+			return err
+		}
+
+		f, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ok, err := o.filter(c, &f, links)
+		if err != nil || !ok {
+			f.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		c.Debugf("Extracting %s", f.Path)
+		err = send(c, out, f)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// filter checks and renames the entry as the options say, it returns
+// false if the entry should be skipped. The entries and symlink targets
+// that go through one of the links, which are the symlinks extracted so
+// far, are unsafe, and the accepted symlinks are added to the links.
+func (o options) filter(c *slurp.C, f *slurp.File, links map[string]bool) (bool, error) {
+	name := strings.Replace(f.Path, `\`, "/", -1)
+
+	if unsafe(name) {
+		if !o.sanitize {
+			return false, fmt.Errorf("Unsafe path %s.", f.Path)
+		}
+		c.Warnf("Sanitizing unsafe path %s.", f.Path)
+		name = strings.TrimLeft(name[len(volume(name)):], "/")
+	}
+	// Rooted, so ".." can't go any higher.
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+
+	if o.strip > 0 {
+		parts := strings.Split(name, "/")
+		if len(parts) <= o.strip {
+			return false, nil
+		}
+		name = path.Join(parts[o.strip:]...)
+	}
+	if name == "" {
+		return false, nil
+	}
+
+	if through(name, links) {
+		if !o.sanitize {
+			return false, fmt.Errorf("Unsafe path %s, it goes through a symlink.", f.Path)
+		}
+		c.Warnf("Skipping %s, it goes through a symlink.", f.Path)
+		return false, nil
+	}
+
+	mode := f.FileInfo.Mode()
+	switch {
+	case mode.IsDir():
+		if !o.dirs {
+			return false, nil
+		}
+	case mode&os.ModeSymlink != 0:
+		if !o.symlinks {
+			return false, nil
+		}
+		target, err := ioutil.ReadAll(f.Reader)
+		slurp.Close(f.Reader)
+		f.Reader = bytes.NewReader(target)
+		if err != nil {
+			return false, err
+		}
+		if unsafeLink(name, string(target), links) {
+			if !o.sanitize {
+				return false, fmt.Errorf("Unsafe symlink %s -> %s.", f.Path, target)
+			}
+			c.Warnf("Skipping unsafe symlink %s -> %s.", f.Path, target)
+			return false, nil
+		}
+	case !mode.IsRegular():
+		return false, nil
+	}
+
+	ok, err := o.match(name)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if mode&os.ModeSymlink != 0 {
+		links[name] = true
+	}
+
+	f.Path = filepath.FromSlash(name)
+	f.FileInfo.SetName(path.Base(name))
+	return true, nil
+}
+
+// match reports whether the entry is included and not excluded.
+func (o options) match(name string) (bool, error) {
+	if len(o.include) > 0 {
+		m, err := matchAny(o.include, name)
+		if err != nil || !m {
+			return false, err
+		}
+	}
+	m, err := matchAny(o.exclude, name)
+	return !m, err
+}
+
+func matchAny(globs []string, name string) (bool, error) {
+	for _, g := range globs {
+		for _, n := range []string{name, path.Base(name)} {
+			m, err := glob.Match(g, n)
+			if err != nil || m {
+				return m, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// unsafe reports whether the slash separated path would end up outside
+// of the directory it is extracted to.
+func unsafe(name string) bool {
+	if path.IsAbs(name) || volume(name) != "" {
+		return true
+	}
+	name = path.Clean(name)
+	return name == ".." || strings.HasPrefix(name, "../")
+}
+
+// through reports whether the slash separated, clean, path is one of
+// the links or is under one of them.
+func through(name string, links map[string]bool) bool {
+	for ; name != "." && name != "/"; name = path.Dir(name) {
+		if links[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// unsafeLink reports whether the target of the symlink name would end
+// up outside of the directory it is extracted to, or goes through any
+// of the links on the way to it.
+func unsafeLink(name, target string, links map[string]bool) bool {
+	if path.IsAbs(target) || volume(target) != "" {
+		return true
+	}
+	dir := path.Dir(name)
+	for _, part := range strings.Split(target, "/") {
+		dir = path.Join(dir, part)
+		if unsafe(dir) || links[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// volume returns the Windows drive letter of the path, if any.
+func volume(name string) string {
+	if len(name) >= 2 && name[1] == ':' && ('a' <= name[0] && name[0] <= 'z' || 'A' <= name[0] && name[0] <= 'Z') {
+		return name[:2]
+	}
+	return ""
+}
+
+// The largest entry kept in memory, the larger entries are spooled to a
+// temporary file that is removed once the entry is closed.
+const maxMemory = 32 << 20
+
+// send reads the entry, so the archive can be read on, and passes it
+// down the pipe.
+func send(c *slurp.C, out chan<- slurp.File, f slurp.File) error {
+	r, size, err := buffer(f.Reader)
+	slurp.Close(f.Reader)
+	if err != nil {
+		return err
+	}
+
+	f.Reader = r
+	f.FileInfo.SetSize(size)
+	out <- f
+	return nil
+}
+
+// buffer reads r into memory, or a temporary file if it is larger than
+// maxMemory, and returns the content and its size.
+func buffer(r io.Reader) (io.Reader, int64, error) {
+	mem := new(bytes.Buffer)
+	n, err := io.CopyN(mem, r, maxMemory+1)
+	if err == io.EOF {
+		return mem, n, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tmp, err := ioutil.TempFile("", "slurp-entry-")
+	if err != nil {
+		return nil, 0, err
+	}
+	t := tempFile{tmp}
+
+	n, err = io.Copy(tmp, io.MultiReader(mem, r))
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		t.Close()
+		return nil, 0, err
+	}
+	return t, n, nil
+}
+
+// tempFile is a temporary file that is removed once closed.
+type tempFile struct {
+	*os.File
+}
+
+func (t tempFile) Close() error {
+	err := t.File.Close()
+	os.Remove(t.Name())
+	return err
+}
+
+// peek reports whether the content of r has magic at the offset.
+func peek(r *bufio.Reader, offset int, magic []byte) bool {
+	head, _ := r.Peek(offset + len(magic))
+	return len(head) == offset+len(magic) && bytes.Equal(head[offset:], magic)
+}
@@ -0,0 +1,188 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/omeid/slurp"
+)
+
+// A tar.bz2 of hello.txt, there is no bzip2 writer in the standard library.
+const helloTarBz2 = "425a6839314159265359d192659800006f7b80c980000240014780008062449e4008082000542528310c041a79045221a00001f777124439a91130ea28657db620901053198ce04d6495d8e759d9ced0a7a35fe3018566568c9110322ee48a70a121a324cb30"
+
+// The bzip2 of hello.
+const helloBz2 = "425a68393141592653591931653d00000081000244a000219a68334d07338bb9229c28480c98b29e80"
+
+func TestExtractFormats(t *testing.T) {
+	c := slurp.NewBuild().C
+
+	hello := testFile{"hello.txt", 0644, "hello"}
+	archive := func(stage slurp.Stage) string {
+		files, _, err := drain(src(hello).Pipe(stage))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files[0].content
+	}
+	unhex := func(s string) string {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	gz := new(bytes.Buffer)
+	w := gzip.NewWriter(gz)
+	w.Write([]byte("hello"))
+	w.Close()
+
+	for _, test := range []struct {
+		name, content string
+	}{
+		{"x.zip", archive(Zip(c, "x.zip"))},
+		// The format is detected from the content, not the name.
+		{"x.tar", archive(Zip(c, "x.zip"))},
+		{"y.tar", archive(Tar(c, "y.tar"))},
+		{"x.tgz", archive(TarGz(c, "x.tgz", gzip.DefaultCompression))},
+		{"x.tar.bz2", unhex(helloTarBz2)},
+		{"hello.txt.gz", gz.String()},
+		{"hello.txt.bz2", unhex(helloBz2)},
+	} {
+		files, _, err := drain(src(testFile{test.name, 0644, test.content}).Pipe(Extract(c)))
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if len(files) != 1 || files[0].path != hello.path || files[0].content != hello.content {
+			t.Fatalf("%s: Expected %v. Got %v", test.name, hello, files)
+		}
+	}
+
+	_, _, err := drain(src(testFile{"x.zip", 0644, "not an archive"}).Pipe(Extract(c)))
+	if err == nil || !strings.Contains(err.Error(), "Unknown archive format.") {
+		t.Fatalf("Expected an unknown format error. Got %v", err)
+	}
+}
+
+func TestExtractBuffered(t *testing.T) {
+	c := slurp.NewBuild().C
+
+	input := []testFile{{"a", 0644, "a"}, {"b", 0644, "b"}, {"c", 0644, "c"}}
+	tarball, _, err := drain(src(input...).Pipe(Tar(c, "x.tar")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Holds on to all the entries before reading any of them.
+	var files []testFile
+	err = src(tarball...).Pipe(Untar(c), func(in <-chan slurp.File, out chan<- slurp.File) {
+		var held []slurp.File
+		for f := range in {
+			held = append(held, f)
+		}
+		for _, f := range held {
+			content := new(bytes.Buffer)
+			content.ReadFrom(f)
+			f.Close()
+			files = append(files, testFile{f.Path, f.FileInfo.Mode(), content.String()})
+		}
+	}).Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, input) {
+		t.Fatalf("Expected %v. Got %v", input, files)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	c := slurp.NewBuild().C
+
+	const (
+		skip = ""
+		fail = "!"
+	)
+	link := os.ModeSymlink | 0777
+
+	for _, test := range []struct {
+		opts []Option
+		// All but the last entry must be extracted.
+		entries []testFile
+		// The path of the last entry, or skip or fail, by default and
+		// with Sanitize.
+		path, sanitized string
+	}{
+		{nil, []testFile{{"a/b.txt", 0644, ""}}, "a/b.txt", "a/b.txt"},
+		{nil, []testFile{{"../../x", 0644, ""}}, fail, "x"},
+		{nil, []testFile{{"/abs", 0644, ""}}, fail, "abs"},
+		{nil, []testFile{{`C:\x`, 0644, ""}}, fail, "x"},
+		{nil, []testFile{{"a/../../x", 0644, ""}}, fail, "x"},
+		{nil, []testFile{{"a/../x", 0644, ""}}, "x", "x"},
+
+		{nil, []testFile{{"l", link, "a"}}, skip, skip},
+		{[]Option{Symlinks()}, []testFile{{"d/l", link, "../a"}}, "d/l", "d/l"},
+		{[]Option{Symlinks()}, []testFile{{"l", link, ".."}}, fail, skip},
+		{[]Option{Symlinks()}, []testFile{{"l", link, "/etc"}}, fail, skip},
+		{[]Option{Symlinks()}, []testFile{{"d/l", link, "../../a"}}, fail, skip},
+		{[]Option{Symlinks()}, []testFile{{"y", link, "."}, {"y/evil", 0644, ""}}, fail, skip},
+		{[]Option{Symlinks()}, []testFile{{"y", link, "."}, {"x", link, "y/.."}}, fail, skip},
+		{[]Option{Symlinks()}, []testFile{{"y", link, "."}, {"y", 0644, ""}}, fail, skip},
+
+		{[]Option{Strip(1)}, []testFile{{"a/b/c", 0644, ""}}, "b/c", "b/c"},
+		{[]Option{Strip(2)}, []testFile{{"a/b", 0644, ""}}, skip, skip},
+		{[]Option{Strip(1)}, []testFile{{"../a/b", 0644, ""}}, fail, "b"},
+
+		{nil, []testFile{{"d", os.ModeDir | 0755, ""}}, skip, skip},
+		{[]Option{Dirs()}, []testFile{{"d", os.ModeDir | 0755, ""}}, "d", "d"},
+
+		{[]Option{Include("*.css")}, []testFile{{"dir/x.css", 0644, ""}}, "dir/x.css", "dir/x.css"},
+		{[]Option{Include("dir/*.css")}, []testFile{{"dir/x.css", 0644, ""}}, "dir/x.css", "dir/x.css"},
+		{[]Option{Include("other/*.css")}, []testFile{{"dir/x.css", 0644, ""}}, skip, skip},
+		{[]Option{Include("*.css")}, []testFile{{"x.js", 0644, ""}}, skip, skip},
+		{[]Option{Exclude("x.css")}, []testFile{{"dir/x.css", 0644, ""}}, skip, skip},
+		{[]Option{Exclude("dir/*")}, []testFile{{"dir/x.css", 0644, ""}}, skip, skip},
+		{[]Option{Exclude("y.css")}, []testFile{{"dir/x.css", 0644, ""}}, "dir/x.css", "dir/x.css"},
+		{[]Option{Include("*.css"), Exclude("dir/*")}, []testFile{{"dir/x.css", 0644, ""}}, skip, skip},
+	} {
+		for _, sanitize := range []bool{false, true} {
+			opts, expected := test.opts, test.path
+			if sanitize {
+				opts, expected = append(append([]Option{}, opts...), Sanitize()), test.sanitized
+			}
+			o := newOptions(opts)
+			links := make(map[string]bool)
+
+			var (
+				got string
+				err error
+			)
+			for i, e := range test.entries {
+				fi := slurp.FileInfo{}
+				fi.SetMode(e.mode)
+				f := slurp.File{Reader: strings.NewReader(e.content), Path: e.path, FileInfo: fi}
+
+				var ok bool
+				ok, err = o.filter(c, &f, links)
+				if i < len(test.entries)-1 && (err != nil || !ok) {
+					t.Fatalf("%v: Expected %s to be extracted. Got %v", test.entries, e.path, err)
+				}
+				got = skip
+				if ok {
+					got = filepath.ToSlash(f.Path)
+				}
+			}
+			if err != nil {
+				got = fail
+			}
+
+			if got != expected {
+				t.Errorf("%v with sanitize %v: Expected %q. Got %q (%v)", test.entries, sanitize, expected, got, err)
+			}
+		}
+	}
+}
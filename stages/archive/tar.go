@@ -0,0 +1,124 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/omeid/slurp"
+)
+
+// Tar archives the files from the input channel and passes the archive
+// down the pipe as a single file with the given name, just like Zip.
+// Files with a symlink mode, such as the symlinks from the extraction
+// stages, are archived as symlinks to their content.
+func Tar(c *slurp.C, name string, opts ...Option) slurp.Stage {
+	return tarball(c.New("stage", "archive.Tar"), name, false, 0, newOptions(opts))
+}
+
+// TarGz is like Tar but compresses the archive with gzip at the given
+// level, see compress/gzip for the levels.
+func TarGz(c *slurp.C, name string, level int, opts ...Option) slurp.Stage {
+	return tarball(c.New("stage", "archive.TarGz"), name, true, level, newOptions(opts))
+}
+
+func tarball(c *slurp.C, name string, gz bool, level int, o options) slurp.Stage {
+	return slurp.Failable(func(in <-chan slurp.File, out chan<- slurp.File) error {
+
+		buf := new(bytes.Buffer)
+
+		var (
+			w   io.Writer = buf
+			zw  *gzip.Writer
+			err error
+		)
+		if gz {
+			zw, err = gzip.NewWriterLevel(buf, level)
+			if err != nil {
+				return err
+			}
+			w = zw
+		}
+		tw := tar.NewWriter(w)
+
+		err = collect(c, in, name, o, func(e entry) error {
+			h := &tar.Header{
+				Name:     e.name,
+				Mode:     int64(e.mode.Perm()),
+				Size:     int64(len(e.content)),
+				ModTime:  e.modTime,
+				Typeflag: tar.TypeReg,
+			}
+			switch {
+			case e.dir():
+				h.Name += "/"
+				h.Typeflag = tar.TypeDir
+			case e.mode&os.ModeSymlink != 0:
+				// The content of symlinks is their target.
+				h.Typeflag = tar.TypeSymlink
+				h.Linkname = string(e.content)
+				h.Size = 0
+			}
+			err := tw.WriteHeader(h)
+			if err != nil || h.Size == 0 {
+				return err
+			}
+			_, err = tw.Write(e.content)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		err = tw.Close()
+		if err != nil {
+			return err
+		}
+		if zw != nil {
+			err = zw.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		out <- archiveFile(name, buf.Bytes(), o)
+		return nil
+	})
+}
+
+// Untar extracts the tar archives from the input channel and passes
+// their entries down the pipe. The archives are extracted one at a time
+// and each entry is read before it is passed on, see Extract.
+// The entries are checked and selected just like Extract.
+func Untar(c *slurp.C, opts ...Option) slurp.Stage {
+	c = c.New("stage", "archive.Untar")
+	o := newOptions(opts)
+	return each(c, func(file slurp.File, out chan<- slurp.File) error {
+		return untar(c, file, out, o)
+	})
+}
+
+// untar sends the regular files, directories and symlinks of the
+// tarball down the pipe, the content of symlinks is their target.
+func untar(c *slurp.C, r io.Reader, out chan<- slurp.File, o options) error {
+	tr := tar.NewReader(r)
+	return extract(c, out, o, func() (slurp.File, error) {
+		for {
+			h, err := tr.Next()
+			if err != nil {
+				return slurp.File{}, err
+			}
+			f := slurp.File{Reader: tr, Path: h.Name, FileInfo: slurp.FileInfoFrom(h.FileInfo())}
+			switch h.Typeflag {
+			case tar.TypeReg, tar.TypeDir:
+				return f, nil
+			case tar.TypeSymlink:
+				f.Reader = strings.NewReader(h.Linkname)
+				return f, nil
+			}
+		}
+	})
+}
@@ -3,53 +3,120 @@
 package archive
 
 import (
+	"archive/zip"
 	"bytes"
+	"io"
 	"io/ioutil"
-	"sync"
-
-	"archive/zip"
+	"os"
 
 	"github.com/omeid/slurp"
 )
 
 // Unzip the zip files from input channel and pass the result
-// to the output channel. 
-func Unzip(c *slurp.C) slurp.Stage {
-	return func(in <-chan slurp.File, out chan<- slurp.File) {
+// to the output channel. The archives are extracted one at a time,
+// and each entry is read before it is passed on, see Extract.
+// Archives that are not read from the disk are spooled to a temporary
+// file first. The entries are checked and selected just like Extract.
+func Unzip(c *slurp.C, opts ...Option) slurp.Stage {
+	c = c.New("stage", "archive.Unzip")
+	o := newOptions(opts)
+	return each(c, func(file slurp.File, out chan<- slurp.File) error {
+		return unzip(c, file, file, out, o)
+	})
+}
+
+// unzip extracts the zip archive file, its content is read from r.
+func unzip(c *slurp.C, file slurp.File, r io.Reader, out chan<- slurp.File, o options) error {
 
-		var wg sync.WaitGroup
-		for file := range in {
+	var (
+		ra   io.ReaderAt
+		size int64
+	)
 
-			wg.Add(1)
-			go func(file slurp.File) {
-				defer wg.Done()
+	if f, ok := file.Reader.(*os.File); ok {
+		s, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		ra, size = f, s.Size()
+	} else {
+		tmp, err := ioutil.TempFile("", "slurp-unzip-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		size, err = io.Copy(tmp, r)
+		if err != nil {
+			return err
+		}
+		ra = tmp
+	}
 
-				raw, err := ioutil.ReadAll(file)
-				file.Close()
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return err
+	}
 
-				r, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
-				if err != nil {
-					c.Error(err)
-					return
-				}
+	if len(zr.File) == 0 {
+		return nil
+	}
+	counter := c.Counter("unzipping", len(zr.File))
 
-				counter := c.Counter("unzipping", len(r.File))
+	i := 0
+	return extract(c, out, o, func() (slurp.File, error) {
+		if i == len(zr.File) {
+			return slurp.File{}, io.EOF
+		}
+		f := zr.File[i]
+		i++
+		counter.Set(i, f.Name)
 
-				// Iterate through the files in the archive,
-				for i, f := range r.File {
-					counter.Set(i+1, f.Name)
+		content, err := f.Open()
+		if err != nil {
+			return slurp.File{}, err
+		}
+		return slurp.File{Reader: content, Dir: "", Path: f.Name, FileInfo: slurp.FileInfoFrom(f.FileInfo())}, nil
+	})
+}
 
-					content, err := f.Open()
-					if err != nil {
-					}
-					fs := slurp.File{Reader: content, Dir: "", Path: f.Name, FileInfo: slurp.FileInfoFrom(f.FileInfo())}
+// Zip archives the files from the input channel and passes the archive
+// down the pipe as a single file with the given name. The entries are
+// named by the path of the files relative to their Dir, and keep their
+// mode and modification time unless the archive is Deterministic.
+func Zip(c *slurp.C, name string, opts ...Option) slurp.Stage {
+	c = c.New("stage", "archive.Zip")
+	o := newOptions(opts)
+	return slurp.Failable(func(in <-chan slurp.File, out chan<- slurp.File) error {
 
-					out <- fs
+		buf := new(bytes.Buffer)
+		w := zip.NewWriter(buf)
 
-				}
-			}(file)
+		err := collect(c, in, name, o, func(e entry) error {
+			h := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: e.modTime}
+			h.SetMode(e.mode)
+			if e.dir() {
+				h.Name += "/"
+				h.Method = zip.Store
+			}
+			fw, err := w.CreateHeader(h)
+			if err != nil {
+				return err
+			}
+			_, err = fw.Write(e.content)
+			return err
+		})
+		if err != nil {
+			return err
+		}
 
+		err = w.Close()
+		if err != nil {
+			return err
 		}
-		wg.Wait()
-	}
+
+		out <- archiveFile(name, buf.Bytes(), o)
+		return nil
+	})
 }
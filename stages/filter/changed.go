@@ -0,0 +1,84 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/omeid/slurp"
+)
+
+// Newer filters out the files that are not newer than their output
+// under dst, that is, where fs.Dest would write them.
+// Directories and files without a modification time are passed on.
+func Newer(c *slurp.C, dst string) slurp.Stage {
+	c = c.New("stage", "filter.Newer")
+	return FilterFunc(c, func(f slurp.File) bool {
+		modTime := f.FileInfo.ModTime()
+		if f.FileInfo.IsDir() || modTime.IsZero() {
+			return false
+		}
+
+		s, err := os.Stat(filepath.Join(dst, f.Rel()))
+		if err != nil || s.ModTime().Before(modTime) {
+			return false
+		}
+		c.Debugf("Up to date %s", f.Path)
+		return true
+	})
+}
+
+// Since filters out the files that haven't changed since the last time
+// the task succeeded, which is kept as the modification time of the
+// stateFile. The stateFile is updated once the task succeeds, but not
+// in a dry run.
+// Directories and files without a modification time are passed on.
+func Since(c *slurp.C, stateFile string) slurp.Stage {
+	c = c.New("stage", "filter.Since")
+	return func(files <-chan slurp.File, out chan<- slurp.File) {
+		start := time.Now()
+
+		var last time.Time
+		s, err := os.Stat(stateFile)
+		switch {
+		case err == nil:
+			last = s.ModTime()
+		case !os.IsNotExist(err):
+			out <- slurp.ErrorFile(err)
+			return
+		}
+
+		for f := range files {
+			modTime := f.FileInfo.ModTime()
+			if f.FileInfo.IsDir() || modTime.IsZero() || modTime.After(last) {
+				out <- f
+				continue
+			}
+			c.Debugf("Unchanged %s", f.Path)
+			f.Close()
+		}
+
+		if !c.DryRun() {
+			c.OnSuccess(func() error {
+				return touch(stateFile, start)
+			})
+		}
+	}
+}
+
+// touch sets the modification time of the file, creating it if needs be.
+func touch(path string, t time.Time) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(path, t, t)
+}
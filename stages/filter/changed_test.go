@@ -0,0 +1,137 @@
+package filter
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/omeid/slurp"
+)
+
+// file returns a file with the modification time.
+func file(path string, modTime time.Time) slurp.File {
+	fi := slurp.FileInfo{}
+	fi.SetName(filepath.Base(path))
+	fi.SetMode(0644)
+	fi.SetModTime(modTime)
+	return slurp.File{Path: path, FileInfo: fi}
+}
+
+// passed returns the paths of the files the stage passes on.
+func passed(stage slurp.Stage, files ...slurp.File) ([]string, error) {
+	pipe := make(chan slurp.File, len(files))
+	for _, f := range files {
+		pipe <- f
+	}
+	close(pipe)
+
+	var paths []string
+	err := slurp.Pipe(pipe).Pipe(stage, func(in <-chan slurp.File, out chan<- slurp.File) {
+		for f := range in {
+			paths = append(paths, f.Path)
+		}
+	}).Wait()
+	return paths, err
+}
+
+func TestNewer(t *testing.T) {
+	dst := t.TempDir()
+	now := time.Now().Truncate(time.Second)
+	for _, name := range []string{"old", "same", "stale"} {
+		path := filepath.Join(dst, name)
+		ioutil.WriteFile(path, nil, 0644)
+		os.Chtimes(path, now, now)
+	}
+
+	paths, err := passed(Newer(slurp.NewBuild().C, dst),
+		file("old", now.Add(-time.Hour)),
+		file("same", now),
+		file("stale", now.Add(time.Hour)),
+		file("missing", now),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"stale", "missing"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Expected %v. Got %v", expected, paths)
+	}
+}
+
+func TestSince(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "state", "since")
+
+	// since runs the files through Since in a task and returns the
+	// paths it passes on.
+	since := func(dryrun bool, fail error, files ...slurp.File) []string {
+		var paths []string
+		b := slurp.NewBuild()
+		b.DryRun = dryrun
+		b.Task(slurp.Task{
+			Name:   "default",
+			Usage:  "default",
+			DryRun: true,
+			Action: func(c *slurp.C) error {
+				var err error
+				paths, err = passed(Since(c, state), files...)
+				if err != nil {
+					return err
+				}
+				return fail
+			},
+		})
+		b.Run(b.C, "default")
+		return paths
+	}
+
+	old := time.Now().Add(-time.Hour)
+	files := []slurp.File{file("a", old), file("b", old)}
+
+	// The runs that must not touch the state.
+	failed := []struct {
+		dryrun bool
+		fail   error
+	}{
+		{true, nil},
+		{false, errors.New("failed")},
+	}
+	for _, test := range failed {
+		paths := since(test.dryrun, test.fail, files...)
+		if len(paths) != 2 {
+			t.Fatalf("Expected all the files on the first run. Got %v", paths)
+		}
+		if _, err := os.Stat(state); !os.IsNotExist(err) {
+			t.Fatalf("Expected no state after a dry run %v or failure %v. Got %v", test.dryrun, test.fail, err)
+		}
+	}
+
+	paths := since(false, nil, files...)
+	if len(paths) != 2 {
+		t.Fatalf("Expected all the files on the first run. Got %v", paths)
+	}
+
+	paths = since(false, nil, file("a", old), file("b", time.Now().Add(time.Hour)))
+	if !reflect.DeepEqual(paths, []string{"b"}) {
+		t.Fatalf("Expected only the changed file. Got %v", paths)
+	}
+
+	s, err := os.Stat(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := s.ModTime()
+	for _, test := range failed {
+		since(test.dryrun, test.fail, files...)
+		s, err := os.Stat(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !s.ModTime().Equal(last) {
+			t.Fatalf("Expected the state untouched by a dry run %v or failure %v. Got %s", test.dryrun, test.fail, s.ModTime())
+		}
+	}
+}
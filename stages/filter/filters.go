@@ -23,6 +23,7 @@ func FilterFunc(c *slurp.C, filter func(slurp.File) bool) slurp.Stage {
 //Filters out files based on a pattern, if they match,
 // they will be closed, otherwise sent to the output channel.
 func Filter(c *slurp.C, pattern string) slurp.Stage {
+	c = c.New("stage", "filter.Filter")
 	return FilterFunc(c, func(f slurp.File) bool {
 		s, err := f.Stat()
 		if err != nil {
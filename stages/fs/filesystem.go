@@ -3,10 +3,8 @@
 package fs
 
 import (
-	"io"
 	"os"
 	"path/filepath"
-	"sync"
 
 	"github.com/omeid/slurp"
 	"github.com/omeid/slurp/tools/glob"
@@ -31,39 +29,43 @@ func Read(path string) (*slurp.File, error) {
 }
 
 //Src returns a channel of slurp.Files that match the provided pattern.
+// It stops globbing when the context is canceled.
 func Src(c *slurp.C, globs ...string) slurp.Pipe {
+	c = c.New("stage", "fs.Src")
 
 	pipe := make(chan slurp.File)
 
-	files, err := glob.Glob(globs...)
-
-	if err != nil {
-		c.Error(err)
-		close(pipe)
-	}
-
-	cwd, err := os.Getwd()
-	if err != nil {
-		c.Error(err)
-		close(pipe)
-		return pipe
-	}
-
 	//TODO: Parse globs here, check for invalid globs, split them into "filters".
 	go func() {
 		defer close(pipe)
 
+		files, err := glob.GlobContext(c, globs...)
+		if err != nil {
+			pipe <- slurp.ErrorFile(err)
+			return
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			pipe <- slurp.ErrorFile(err)
+			return
+		}
+
 		for matchpair := range files {
 
 			f, err := Read(matchpair.Name)
 			if err != nil {
-				c.Error(err)
+				pipe <- slurp.ErrorFile(err)
 				continue
 			}
 
 			f.Cwd = cwd
 			f.Dir = glob.Dir(matchpair.Glob)
-			pipe <- *f
+			pipe <- c.Track(*f)
+		}
+
+		if err := c.Err(); err != nil {
+			pipe <- slurp.ErrorFile(err)
 		}
 
 	}()
@@ -72,42 +74,74 @@ func Src(c *slurp.C, globs ...string) slurp.Pipe {
 }
 
 // Dest writes the files from the input channel to the dst folder and closes the files.
-// It never returns Files.
-func Dest(c *slurp.C, dst string) slurp.Stage {
-	return func(files <-chan slurp.File, out chan<- slurp.File) {
-
-		var wg sync.WaitGroup
-		defer wg.Wait()
-
-		for file := range files {
-
-			realpath, _ := filepath.Rel(file.Dir, file.Path)
-			path := filepath.Join(dst, filepath.Dir(realpath))
-			err := os.MkdirAll(path, 0700)
-			if err != nil {
-				c.Error(err)
-				return
-			}
+// It never returns Files, but write errors are passed down the pipe.
+// The files are written in parallel, see slurp.Parallel.
+// Directories are created and symlinks, files with os.ModeSymlink and
+// the target as their content, are linked.
+// Existing files are overwritten and new directories get 0700, see the
+// Options for the other choices.
+// In a dry run, it only logs the paths it would write.
+func Dest(c *slurp.C, dst string, opts ...Option) slurp.Stage {
+	c = c.New("stage", "fs.Dest")
+	o := newOptions(opts)
+	return slurp.Parallel(c, 0, func(c *slurp.C, file slurp.File) (slurp.File, error) {
+		defer file.Close()
+		_, err := o.dest(c, dst, file)
+		return slurp.File{}, err
+	})
+}
 
-			if !file.FileInfo.IsDir() {
+// Copy is like Dest but passes the written files down the pipe, read
+// back from dst. Directories and symlinks are not passed on.
+// In a dry run, it logs the paths it would write and passes the files
+// on untouched.
+func Copy(c *slurp.C, dst string, opts ...Option) slurp.Stage {
+	c = c.New("stage", "fs.Copy")
+	o := newOptions(opts)
+	return slurp.ParallelOrdered(c, 0, func(c *slurp.C, file slurp.File) (slurp.File, error) {
+		if c.DryRun() {
+			o.dest(c, dst, file)
+			return file, nil
+		}
 
-				wg.Add(1)
-				go func(file slurp.File) {
+		defer file.Close()
+		path, err := o.dest(c, dst, file)
+		if err != nil || !file.FileInfo.Mode().IsRegular() {
+			return slurp.File{}, err
+		}
 
-					defer wg.Done()
-					defer file.Close()
+		f, err := Read(path)
+		if err != nil {
+			return slurp.File{}, err
+		}
+		f.Cwd = file.Cwd
+		f.Dir = dst
+		return *f, nil
+	})
+}
 
-					realfile, err := os.Create(filepath.Join(dst, realpath))
-					if err != nil {
-						c.Error(err)
-						return
-					}
-					io.Copy(realfile, file)
-					realfile.Close()
+// dest writes the file under dst and returns its path.
+func (o options) dest(c *slurp.C, dst string, file slurp.File) (string, error) {
+	path := filepath.Join(dst, file.Rel())
 
-				}(file)
-			}
+	if c.DryRun() {
+		if !file.FileInfo.IsDir() {
+			c.Infof("Would write %s", path)
 		}
+		return path, nil
+	}
+	err := os.MkdirAll(filepath.Dir(path), o.dirMode)
+	if err != nil {
+		return path, err
+	}
 
+	if file.FileInfo.IsDir() {
+		return path, os.MkdirAll(path, o.dirMode)
 	}
+
+	if file.FileInfo.Mode()&os.ModeSymlink != 0 {
+		return path, o.symlink(path, file)
+	}
+
+	return path, o.write(c, path, file)
 }
@@ -0,0 +1,189 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/omeid/slurp"
+	"github.com/omeid/slurp/tools/glob"
+)
+
+// Clean removes the files and directories that match the globs, along
+// with everything in them. It refuses to remove anything that is not
+// inside the working directory, or the working directory itself, and
+// then nothing is removed.
+// In a dry run, it only logs the paths it would remove.
+func Clean(c *slurp.C, globs ...string) error {
+	c = c.New("stage", "fs.Clean")
+
+	matches, err := glob.GlobContext(c, globs...)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for m := range matches {
+		paths = append(paths, m.Name)
+	}
+	if err := c.Err(); err != nil {
+		return err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	cwd, err = filepath.EvalSymlinks(cwd)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		err := inside(cwd, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		if c.DryRun() {
+			c.Infof("Would remove %s", path)
+			continue
+		}
+		c.Infof("Removing %s", path)
+		err := os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inside returns an error unless the path is inside the directory dir,
+// which must have no symlinks.
+func inside(dir, path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	// The path itself may be a symlink, it is removed and not what it
+	// points to, but the directories leading to it must be inside.
+	parent, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(dir, filepath.Join(parent, filepath.Base(abs)))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("Refusing to remove %s, it is not inside the working directory.", path)
+	}
+	return nil
+}
+
+// Mkdir creates the directories, along with any missing parents, with
+// the permissions perm. Existing directories are left alone.
+// In a dry run, it only logs the directories it would create.
+func Mkdir(c *slurp.C, perm os.FileMode, paths ...string) error {
+	c = c.New("stage", "fs.Mkdir")
+	for _, path := range paths {
+		if c.DryRun() {
+			c.Infof("Would create %s", path)
+			continue
+		}
+		c.Debugf("Creating %s", path)
+		err := os.MkdirAll(path, perm)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Symlink links the files from the input channel, which must be on the
+// disk, say from Src, under dst just like Dest writes them, and closes
+// them. The links point to the absolute path of the files.
+// It never returns Files, but errors are passed down the pipe.
+// In a dry run, it only logs the links it would create.
+func Symlink(c *slurp.C, dst string, opts ...Option) slurp.Stage {
+	c = c.New("stage", "fs.Symlink")
+	o := newOptions(opts)
+	return slurp.Parallel(c, 0, func(c *slurp.C, file slurp.File) (slurp.File, error) {
+		file.Close()
+
+		target, path, err := ondisk(dst, file)
+		if err != nil {
+			return slurp.File{}, err
+		}
+		target, err = filepath.Abs(target)
+		if err != nil {
+			return slurp.File{}, err
+		}
+
+		if c.DryRun() {
+			c.Infof("Would link %s to %s", path, target)
+			return slurp.File{}, nil
+		}
+		c.Debugf("Linking %s to %s", path, target)
+
+		err = os.MkdirAll(filepath.Dir(path), o.dirMode)
+		if err != nil {
+			return slurp.File{}, err
+		}
+		return slurp.File{}, o.link(path, target)
+	})
+}
+
+// Move renames the files from the input channel, which must be on the
+// disk, say from Src, to dst just like Dest writes them, and closes
+// them. The files are renamed, so dst must be on the same filesystem.
+// It never returns Files, but errors are passed down the pipe.
+// In a dry run, it only logs the files it would move.
+func Move(c *slurp.C, dst string, opts ...Option) slurp.Stage {
+	c = c.New("stage", "fs.Move")
+	o := newOptions(opts)
+	return slurp.Parallel(c, 0, func(c *slurp.C, file slurp.File) (slurp.File, error) {
+		file.Close()
+
+		src, path, err := ondisk(dst, file)
+		if err != nil {
+			return slurp.File{}, err
+		}
+
+		if c.DryRun() {
+			c.Infof("Would move %s to %s", src, path)
+			return slurp.File{}, nil
+		}
+		c.Debugf("Moving %s to %s", src, path)
+
+		err = os.MkdirAll(filepath.Dir(path), o.dirMode)
+		if err != nil {
+			return slurp.File{}, err
+		}
+
+		if o.noOverwrite {
+			if _, err := os.Lstat(path); err == nil {
+				return slurp.File{}, fmt.Errorf("%s already exists.", path)
+			}
+		}
+		return slurp.File{}, os.Rename(src, path)
+	})
+}
+
+// ondisk returns the path of the file on the disk and where it goes
+// under dst.
+func ondisk(dst string, file slurp.File) (string, string, error) {
+	if file.Cwd == "" {
+		return "", "", fmt.Errorf("%s is not on the disk.", file.Path)
+	}
+
+	src := file.Path
+	if !filepath.IsAbs(src) {
+		src = filepath.Join(file.Cwd, src)
+	}
+
+	return src, filepath.Join(dst, file.Rel()), nil
+}
@@ -0,0 +1,64 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/omeid/slurp"
+)
+
+func TestClean(t *testing.T) {
+	c := slurp.NewBuild().C
+
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+
+	root := t.TempDir()
+	outside := filepath.Join(root, "outside")
+	os.Mkdir(outside, 0755)
+	ioutil.WriteFile(filepath.Join(outside, "keep"), []byte("keep"), 0644)
+
+	work := filepath.Join(root, "work")
+	os.MkdirAll(filepath.Join(work, "public", "css"), 0755)
+	ioutil.WriteFile(filepath.Join(work, "public", "css", "x.css"), []byte("x"), 0644)
+	os.Symlink(outside, filepath.Join(work, "link"))
+	os.Chdir(work)
+
+	exists := func(path string) bool {
+		_, err := os.Lstat(path)
+		return err == nil
+	}
+
+	for _, globs := range [][]string{
+		{"../outside"},
+		{"."},
+		{filepath.Join(root, "outside", "keep")},
+		{"link/keep"},
+		// Nothing is removed if any of the paths is outside.
+		{"public", "../outside"},
+	} {
+		err := Clean(c, globs...)
+		if err == nil || !strings.Contains(err.Error(), "Refusing") {
+			t.Fatalf("Expected %v to be refused. Got %v", globs, err)
+		}
+		for _, path := range []string{"public/css/x.css", "../outside/keep"} {
+			if !exists(path) {
+				t.Fatalf("Expected %s to be kept by %v.", path, globs)
+			}
+		}
+	}
+
+	// The symlink is removed, not what it points to.
+	err := Clean(c, "public", "link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range map[string]bool{"public": false, "link": false, "../outside/keep": true} {
+		if exists(path) != expected {
+			t.Fatalf("Expected %s to exist to be %v.", path, expected)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/omeid/slurp"
+)
+
+// Option configures how Dest writes the files.
+type Option func(*options)
+
+type options struct {
+	preserve    bool
+	skip        skip
+	noOverwrite bool
+	atomic      bool
+	dirMode     os.FileMode
+}
+
+// How to tell that a file is unchanged.
+type skip int
+
+const (
+	skipNone skip = iota
+	skipModTime
+	skipContent
+)
+
+func newOptions(opts []Option) options {
+	o := options{dirMode: 0700}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Preserve sets the mode and modification time of the written files to
+// the ones in their FileInfo, when they are known.
+func Preserve() Option {
+	return func(o *options) {
+		o.preserve = true
+	}
+}
+
+// SkipUnchanged doesn't write the files that already exist with the
+// same size and modification time as their FileInfo, which is only
+// the case for files written with Preserve.
+func SkipUnchanged() Option {
+	return func(o *options) {
+		o.skip = skipModTime
+	}
+}
+
+// SkipSameContent doesn't write the files that already exist with the
+// same content, the content is compared by its SHA-256 hash.
+func SkipSameContent() Option {
+	return func(o *options) {
+		o.skip = skipContent
+	}
+}
+
+// NoOverwrite fails rather than overwriting existing files.
+func NoOverwrite() Option {
+	return func(o *options) {
+		o.noOverwrite = true
+	}
+}
+
+// Atomic writes every file to a temporary file next to it and renames
+// it into place, so the file is never seen half written. New files get
+// 0644 unless their mode is preserved.
+func Atomic() Option {
+	return func(o *options) {
+		o.atomic = true
+	}
+}
+
+// DirMode sets the permissions of the directories that are created.
+func DirMode(perm os.FileMode) Option {
+	return func(o *options) {
+		o.dirMode = perm
+	}
+}
+
+// symlink creates a symlink at path to the target read from r,
+// replacing any existing file.
+func (o options) symlink(path string, r io.Reader) error {
+	target, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return o.link(path, string(target))
+}
+
+// link creates a symlink at path to the target, replacing any existing
+// file.
+func (o options) link(path, target string) error {
+	_, err := os.Lstat(path)
+	switch {
+	case err == nil && o.noOverwrite:
+		return fmt.Errorf("%s already exists.", path)
+	case err == nil:
+		err = os.Remove(path)
+		if err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+	return os.Symlink(target, path)
+}
+
+// write writes the content of the file to path.
+func (o options) write(c *slurp.C, path string, file slurp.File) error {
+	existing, err := os.Lstat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	exists := err == nil
+
+	if exists && o.noOverwrite {
+		return fmt.Errorf("%s already exists.", path)
+	}
+
+	var r io.Reader = file
+	if exists && existing.Mode().IsRegular() {
+		switch o.skip {
+		case skipModTime:
+			modTime := file.FileInfo.ModTime()
+			if !modTime.IsZero() && existing.Size() == file.FileInfo.Size() && existing.ModTime().Truncate(time.Second).Equal(modTime.Truncate(time.Second)) {
+				c.Debugf("Skipping unchanged %s", path)
+				return nil
+			}
+		case skipContent:
+			content, err := ioutil.ReadAll(file)
+			if err != nil {
+				return err
+			}
+			same, err := sameContent(path, content)
+			if err != nil {
+				return err
+			}
+			if same {
+				c.Debugf("Skipping unchanged %s", path)
+				return nil
+			}
+			r = bytes.NewReader(content)
+		}
+	}
+
+	// Never write through an existing symlink.
+	if exists && existing.Mode()&os.ModeSymlink != 0 {
+		err := os.Remove(path)
+		if err != nil {
+			return err
+		}
+		exists = false
+	}
+
+	if !o.atomic {
+		err = write(path, r)
+		if err != nil {
+			return err
+		}
+		return o.finish(path, file.FileInfo)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, r)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+
+	if err == nil {
+		mode := os.FileMode(0644)
+		if exists {
+			mode = existing.Mode().Perm()
+		}
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = o.finish(tmp.Name(), file.FileInfo)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// finish sets the mode and modification time of the written file, if
+// they are to be preserved.
+func (o options) finish(path string, fi slurp.FileInfo) error {
+	if !o.preserve {
+		return nil
+	}
+
+	if perm := fi.Mode().Perm(); perm != 0 {
+		err := os.Chmod(path, perm)
+		if err != nil {
+			return err
+		}
+	}
+
+	if modTime := fi.ModTime(); !modTime.IsZero() {
+		return os.Chtimes(path, modTime, modTime)
+	}
+	return nil
+}
+
+func write(path string, r io.Reader) error {
+	realfile, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(realfile, r)
+	if e := realfile.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// sameContent reports whether the file at path has the content.
+func sameContent(path string, content []byte) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(content)
+	return bytes.Equal(h.Sum(nil), sum[:]), nil
+}
@@ -0,0 +1,233 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omeid/slurp"
+)
+
+// file returns a file with the content, mode and modification time.
+func file(path, content string, mode os.FileMode, modTime time.Time) slurp.File {
+	fi := slurp.FileInfo{}
+	fi.SetName(filepath.Base(path))
+	fi.SetSize(int64(len(content)))
+	fi.SetMode(mode)
+	fi.SetModTime(modTime)
+	return slurp.File{Reader: strings.NewReader(content), Path: path, FileInfo: fi}
+}
+
+// dest writes the files to dst with Dest.
+func dest(dst string, opts []Option, files ...slurp.File) error {
+	pipe := make(chan slurp.File, len(files))
+	for _, f := range files {
+		pipe <- f
+	}
+	close(pipe)
+	return slurp.Pipe(pipe).Pipe(Dest(slurp.NewBuild().C, dst, opts...)).Wait()
+}
+
+func read(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestNoOverwrite(t *testing.T) {
+	dst := t.TempDir()
+	path := filepath.Join(dst, "a")
+	ioutil.WriteFile(path, []byte("old"), 0644)
+
+	err := dest(dst, []Option{NoOverwrite()}, file("a", "new", 0644, time.Now()))
+	if err == nil {
+		t.Fatal("Expected an error for an existing file.")
+	}
+	if got := read(t, path); got != "old" {
+		t.Fatalf("Expected old. Got %s", got)
+	}
+
+	err = dest(dst, []Option{NoOverwrite()}, file("b", "new", 0644, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dest(dst, nil, file("a", "new", 0644, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, path); got != "new" {
+		t.Fatalf("Expected new. Got %s", got)
+	}
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	dst := t.TempDir()
+	path := filepath.Join(dst, "a")
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	err := dest(dst, []Option{Preserve()}, file("a", "old", 0600, modTime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Mode().Perm() != 0600 || !s.ModTime().Equal(modTime) {
+		t.Fatalf("Expected 0600 at %s. Got %s at %s", modTime, s.Mode(), s.ModTime())
+	}
+
+	// The same size and modification time, so it is skipped.
+	opts := []Option{Preserve(), SkipUnchanged()}
+	err = dest(dst, opts, file("a", "new", 0600, modTime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, path); got != "old" {
+		t.Fatalf("Expected the unchanged file to be skipped. Got %s", got)
+	}
+
+	err = dest(dst, opts, file("a", "new", 0600, modTime.Add(time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, path); got != "new" {
+		t.Fatalf("Expected the newer file to be written. Got %s", got)
+	}
+
+	err = dest(dst, opts, file("a", "newer", 0600, modTime.Add(time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, path); got != "newer" {
+		t.Fatalf("Expected the resized file to be written. Got %s", got)
+	}
+}
+
+func TestSkipSameContent(t *testing.T) {
+	dst := t.TempDir()
+	path := filepath.Join(dst, "a")
+	ioutil.WriteFile(path, []byte("same"), 0644)
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(path, old, old)
+
+	opts := []Option{SkipSameContent()}
+	err := dest(dst, opts, file("a", "same", 0644, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.ModTime().Equal(old) {
+		t.Fatalf("Expected the file with the same content not to be written. Got %s", s.ModTime())
+	}
+
+	err = dest(dst, opts, file("a", "diff", 0644, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, path); got != "diff" {
+		t.Fatalf("Expected diff. Got %s", got)
+	}
+}
+
+// failing fails after the content is read.
+type failing struct {
+	io.Reader
+}
+
+func (f failing) Read(p []byte) (int, error) {
+	n, err := f.Reader.Read(p)
+	if err == io.EOF {
+		err = errors.New("read failed")
+	}
+	return n, err
+}
+
+func TestAtomic(t *testing.T) {
+	dst := t.TempDir()
+	path := filepath.Join(dst, "a")
+	ioutil.WriteFile(path, []byte("old"), 0600)
+
+	entries := func() []string {
+		infos, err := ioutil.ReadDir(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, fi := range infos {
+			names = append(names, fi.Name())
+		}
+		return names
+	}
+
+	f := file("a", "new", 0644, time.Now())
+	f.Reader = failing{f.Reader}
+	err := dest(dst, []Option{Atomic()}, f)
+	if err == nil {
+		t.Fatal("Expected the read error.")
+	}
+	if got := read(t, path); got != "old" {
+		t.Fatalf("Expected the file untouched. Got %s", got)
+	}
+	if names := entries(); len(names) != 1 {
+		t.Fatalf("Expected no temporary file left behind. Got %v", names)
+	}
+
+	err = dest(dst, []Option{Atomic()}, file("a", "new", 0644, time.Now()), file("b", "b", 0755, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, path); got != "new" {
+		t.Fatalf("Expected new. Got %s", got)
+	}
+	if names := entries(); len(names) != 2 {
+		t.Fatalf("Expected no temporary file left behind. Got %v", names)
+	}
+
+	for name, mode := range map[string]os.FileMode{"a": 0600, "b": 0644} {
+		s, err := os.Stat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Mode().Perm() != mode {
+			t.Fatalf("Expected %s with %s. Got %s", name, mode, s.Mode().Perm())
+		}
+	}
+}
+
+func TestDirMode(t *testing.T) {
+	for _, test := range []struct {
+		opts []Option
+		mode os.FileMode
+	}{
+		{nil, 0700},
+		{[]Option{DirMode(0750)}, 0750},
+	} {
+		dst := filepath.Join(t.TempDir(), "out")
+		err := dest(dst, test.opts, file("a/b/c", "c", 0644, time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, dir := range []string{"", "a", "a/b"} {
+			s, err := os.Stat(filepath.Join(dst, dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Mode().Perm() != test.mode {
+				t.Fatalf("Expected %s/%s with %s. Got %s", dst, dir, test.mode, s.Mode().Perm())
+			}
+		}
+	}
+}
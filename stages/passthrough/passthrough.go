@@ -7,8 +7,11 @@ and pipe it to passtrhough to be processed by your designed program.
 package passthrough
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
 
 	"github.com/omeid/slurp"
@@ -17,41 +20,103 @@ import (
 // bin is the binary name, it will be passed to os/exec.Command, so the same
 // path rules applies.
 // the args are the argumetns passed to the program.
+// The output of the programs is streamed down the pipe in the same order
+// as the input. Every program takes one of the -j slots shared with the
+// Parallel stages, see slurp.Acquire, until its output is read to the
+// end or closed, so the following stages must read or close the files
+// as they come. Closing a file returns the error of its program.
+// The running programs are killed when the context is canceled. In a dry
+// run, it only logs the command lines and passes the files on untouched.
 func Run(c *slurp.C, bin string, args ...string) slurp.Stage {
-	return func(in <-chan slurp.File, out chan<- slurp.File) {
-
-		var wg sync.WaitGroup
-		defer wg.Wait()
-
+	c = c.New("stage", "passthrough.Run")
+	return slurp.Failable(func(in <-chan slurp.File, out chan<- slurp.File) error {
 		for file := range in {
+			if c.DryRun() {
+				c.Infof("Would run %s < %s", strings.Join(append([]string{bin}, args...), " "), file.Path)
+				out <- file
+				continue
+			}
 
-			cmd := exec.Command(bin, args...)
-			cmd.Stderr = os.Stderr //TODO: io.Writer logger.
+			// The input of a running program holds a slot already.
+			release := func() {}
+			if h, ok := file.Reader.(slurp.SlotHolder); !ok || !h.HoldsSlot() {
+				err := slurp.Acquire(c)
+				if err != nil {
+					file.Close()
+					return err
+				}
+				release = slurp.Release
+			}
 
+			cmd := exec.CommandContext(c, bin, args...)
+			cmd.Stderr = os.Stderr //TODO: io.Writer logger.
 			cmd.Stdin = file.Reader
-			content, err := cmd.StdoutPipe()
+
+			stdout, err := cmd.StdoutPipe()
+			if err == nil {
+				err = cmd.Start()
+			}
 			if err != nil {
-				c.Error(err)
-				return
+				release()
+				file.Close()
+				return fmt.Errorf("%s: %s", bin, err)
 			}
 
-			err = cmd.Start()
-			if err != nil {
-				c.Error(err)
-				return
+			file.Reader = &output{
+				ReadCloser: stdout,
+				cmd:        cmd,
+				input:      file.Reader,
+				done:       release,
 			}
+			// Unknown until the program is done.
+			file.FileInfo.SetSize(-1)
+			out <- file
+		}
+		return nil
+	})
+}
 
-			wg.Add(1)
-			go func(cmd *exec.Cmd) {
-				defer wg.Done()
-				defer slurp.Close(content)
-				cmd.Wait()
-			}(cmd)
+// output is the stdout of a running program, the program is waited for
+// once the output is read to the end or closed.
+type output struct {
+	io.ReadCloser
+	cmd   *exec.Cmd
+	input io.Reader
+	done  func()
 
-			file.Reader = content
-			out <- file
+	once sync.Once
+	err  error
+}
 
+func (o *output) Read(p []byte) (int, error) {
+	n, err := o.ReadCloser.Read(p)
+	if err == io.EOF {
+		if werr := o.wait(); werr != nil {
+			err = werr
 		}
-
 	}
+	return n, err
+}
+
+func (o *output) Close() error {
+	return o.wait()
+}
+
+// HoldsSlot implements slurp.SlotHolder.
+func (o *output) HoldsSlot() bool {
+	return true
+}
+
+func (o *output) wait() error {
+	o.once.Do(func() {
+		defer o.done()
+		// Unblocks the program if the output wasn't read to the end.
+		o.ReadCloser.Close()
+		err := o.cmd.Wait()
+		slurp.Close(o.input)
+		if err != nil {
+			o.err = fmt.Errorf("%s: %s", o.cmd.Args[0], err)
+		}
+	})
+	return o.err
 }
@@ -14,7 +14,7 @@ import (
 // It creates an increamental collection of templates that allows accessing
 // templates from templates (Just pass the "required" templates first.)
 func HTML(c *slurp.C, data interface{}) slurp.Stage {
-	return func(in <-chan slurp.File, out chan<- slurp.File) {
+	return slurp.Failable(func(in <-chan slurp.File, out chan<- slurp.File) error {
 
 		templates := template.New("")
 
@@ -24,32 +24,29 @@ func HTML(c *slurp.C, data interface{}) slurp.Stage {
 			_, err := buf.ReadFrom(f.Reader)
 			f.Close()
 			if err != nil {
-				c.Error(err)
-				break
+				return err
 			}
 
 			s, err := f.Stat()
 			if err != nil {
-			  c.Errorf("Can't get File Stat: %s", err.Error())
-				break
+				return err
 			}
 
 			template, err := templates.New(s.Name()).Parse(buf.String())
 			if err != nil {
-				c.Error(err)
-				break
+				return err
 			}
 
 			buff := new(bytes.Buffer)
 			err = template.Execute(buff, data)
 			if err != nil {
-			  c.Error(err)
-			  break
+				return err
 			}
 
 			f.Reader = buff
 
 			out <- f
 		}
-	}
+		return nil
+	})
 }
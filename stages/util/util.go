@@ -9,7 +9,8 @@ import (
 // Concatenates all the files from the input channel
 // and passes them to output channel with the given name.
 func Concat(c *slurp.C, name string) slurp.Stage {
-	return func(files <-chan slurp.File, out chan<- slurp.File) {
+	c = c.New("stage", "util.Concat")
+	return slurp.Failable(func(files <-chan slurp.File, out chan<- slurp.File) error {
 
 		var (
 			size    int64
@@ -19,14 +20,12 @@ func Concat(c *slurp.C, name string) slurp.Stage {
 		for f := range files {
 			c.Infof("Adding %s to %s", f.Path, name)
 			n, err := bigfile.ReadFrom(f)
+			f.Close()
 			if err != nil {
-				c.Error(err)
-				return
+				return err
 			}
 			bigfile.WriteRune('\n')
 			size += n + 1
-
-			f.Close()
 		}
 
 		fi := slurp.FileInfo{}
@@ -39,7 +38,8 @@ func Concat(c *slurp.C, name string) slurp.Stage {
 			Path:     name,
 			FileInfo: fi,
 		}
-	}
+		return nil
+	})
 }
 
 // A simple transformation slurp.Stage, sends the file to output
@@ -54,6 +54,7 @@ func Do(do func(slurp.File) slurp.File) slurp.Stage {
 
 //For The Glory of Debugging.
 func List(c *slurp.C) slurp.Stage {
+	c = c.New("stage", "util.List")
 	return func(files <-chan slurp.File, out chan<- slurp.File) {
 		for f := range files {
 			s, err := f.Stat()
@@ -7,7 +7,10 @@ import (
 
 // Gets  the list of urls and passes the results to output channel.
 // It reports the progress to the Context using a ReadProgress proxy.
+// The downloads are aborted when the context is canceled. In a dry run,
+// it only logs the urls and passes nothing on.
 func Get(c *slurp.C, urls ...string) slurp.Pipe {
+	c = c.New("stage", "web.Get")
 
 	out := make(chan slurp.File)
 
@@ -16,17 +19,27 @@ func Get(c *slurp.C, urls ...string) slurp.Pipe {
 
 		for _, url := range urls {
 
+			if err := c.Err(); err != nil {
+				out <- slurp.ErrorFile(err)
+				return
+			}
+
+			if c.DryRun() {
+				c.Infof("Would download %s", url)
+				continue
+			}
+
 			c.Infof("Downloading %s", url)
 
-			file, err := http.Get(url)
+			file, err := http.GetContext(c, url)
 			if err != nil {
-				c.Error(err)
+				out <- slurp.ErrorFile(err)
 				continue
 			}
 
 			s, _ := file.Stat()
 			file.Reader = c.ReadProgress(file.Reader, "Downloading "+file.Path, s.Size())
-			out <- file
+			out <- c.Track(file)
 		}
 	}()
 
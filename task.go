@@ -1,9 +1,13 @@
 package slurp
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // The type of function to call when a task is invoked.
@@ -18,44 +22,129 @@ type Task struct {
 	Description string
 	// List of dependencies.
 	Deps []string
+	// The command-line flags of the task, they are parsed from the
+	// arguments that follow the task name and are available to the
+	// Action through C.Flag. Optional.
+	Flags *flag.FlagSet
 	// The function to call when the task is invoked.
 	Action Action
+
+	// Globs of the files, or directories, the task reads. If set, the
+	// task is skipped once it has succeeded, when its Outputs are newer
+	// than its Inputs or the content of its Inputs hasn't changed since
+	// its last successful run. Optional.
+	Inputs []string
+	// The files or directories the task writes. Optional.
+	Outputs []string
+
+	// The maximum time the Action can take, the context of the Action
+	// is canceled once exceeded and the task fails once the Action
+	// returns. Optional.
+	Timeout time.Duration
+	// The number of times to retry the Action if it fails. Optional.
+	Retries int
+	// The delay before the first retry, it doubles for every retry
+	// after. Defaults to a second.
+	Backoff time.Duration
+
+	// The Action supports dry runs, see C.DryRun. The Actions of the
+	// other tasks are not called in a dry run. Optional.
+	DryRun bool
 }
 
 type task struct {
 	Task
 
-	deps  taskstack
+	// Set while the action is running, accessed atomically.
+	running int32
+}
+
+type taskstack map[string]*task
+
+// run holds the state of a single build invocation.
+// Every task is executed at most once per run and all of its
+// dependents wait for, and share, the same result.
+type run struct {
+	build *Build
+
+	// The root context of the run, tasks are always started
+	// from it regardless of who asked for them first.
+	c *C
+
+	// Cancels the run, on the first failure unless the build
+	// keeps going.
+	cancel context.CancelFunc
 
-	lock sync.Mutex
+	lock    sync.Mutex
+	results map[string]*result
 
-	done    <-chan struct{}
-	running bool
+	report report
 }
 
-type taskstack map[string]*task
+type result struct {
+	done chan struct{}
+	err  error
+}
 
-func (t *task) run(c *C) error {
+func newRun(b *Build, c *C) *run {
+	ctx, cancel := context.WithCancel(c.Context)
+	r := &run{build: b, cancel: cancel, results: make(map[string]*result)}
+	r.c = &C{Context: ctx, Log: c.Log, dryrun: c.dryrun || b.DryRun, run: r}
+	return r
+}
+
+// do runs the task unless it has already been started in this run,
+// in which case it waits for it to finish and returns its error.
+func (r *run) do(t *task) error {
+	r.lock.Lock()
+	res, started := r.results[t.Name]
+	if !started {
+		res = &result{done: make(chan struct{})}
+		r.results[t.Name] = res
+	}
+	r.lock.Unlock()
+
+	if started {
+		<-res.done
+		return res.err
+	}
+
+	rep := r.report.add(t)
+	res.err = t.run(r.c, rep)
+	if rep.Status == statusFailed && !r.build.KeepGoing {
+		r.cancel()
+	}
+	close(res.done)
+	return res.err
+}
+
+func (t *task) run(c *C, rep *taskReport) (err error) {
 
-	t.lock.Lock()
 	c.Notice(t.Name)
 	defer func() {
-		t.running = false
-		t.lock.Unlock()
+		atomic.StoreInt32(&t.running, 0)
+		rep.finish(err)
+		if group := c.run.build.group; group != nil {
+			group.Flush(t.Name)
+		}
 	}()
 
+	c = c.New("task", t.Name)
+	c.flags = t.Flags
+	c.report = rep
+
 	if t.Name != "default" {
-		c = c.New(fmt.Sprintf("%s: ", t.Name))
 		c.Notice("Starting.")
 	}
 
+	deps := c.run.build.dependencies(t)
 	failed := make(chan string)
-	cancel := make(chan struct{}, len(t.deps))
+	cancel := make(chan struct{}, 1)
 	done := make(chan struct{})
 	var wg sync.WaitGroup
 	go func(failed chan string) {
 		defer close(failed)
-		for _, t := range t.deps {
+		for _, t := range deps {
 			select {
 			case <-cancel:
 				break
@@ -63,8 +152,8 @@ func (t *task) run(c *C) error {
 				wg.Add(1)
 				go func(t *task) {
 					defer wg.Done()
-					c.Infof("Waiting for %s", t.Name)
-					err := t.run(c)
+					c.Debugf("Waiting for %s", t.Name)
+					err := c.run.do(t)
 					if err != nil {
 						c.Error(err)
 						failed <- t.Name
@@ -79,10 +168,11 @@ func (t *task) run(c *C) error {
 	var failedjobs []string
 
 	select {
-	case <-t.done:
+	case <-c.Done():
 		cancel <- struct{}{}
-		c.Warn("Task Canacled. Reasons: Canacled build.")
-		return nil
+		// Wait for the dependencies to stop.
+		for range failed {
+		}
 	case fail, ok := <-failed:
 		if ok {
 			cancel <- struct{}{}
@@ -91,15 +181,134 @@ func (t *task) run(c *C) error {
 			for fail = range failed {
 				failedjobs = append(failedjobs, fail)
 			}
+			rep.Status = statusCancelled
 			return fmt.Errorf("Task Canacled. Reason: Failed Dependency (%s).", strings.Join(failedjobs, ","))
 		}
 	case <-done:
 	}
 
-	t.running = true
-	err := t.Action(c)
-	if err == nil {
-		c.Notice("Done.")
+	if c.Err() != nil {
+		c.Warn("Task Canacled. Reasons: Canacled build.")
+		rep.Status = statusCancelled
+		return nil
+	}
+
+	// The time of the task itself, without its dependencies.
+	rep.Start = time.Now()
+
+	var hash string
+	if t.incremental() {
+		uptodate, h, err := t.uptodate(&c.run.build.state)
+		if err != nil {
+			return err
+		}
+		if uptodate {
+			c.Notice("Up to date.")
+			rep.Status = statusSkipped
+			return nil
+		}
+		hash = h
+	}
+
+	if c.DryRun() && !t.DryRun {
+		c.Notice("Would run.")
+		rep.Status = statusSkipped
+		return nil
+	}
+
+	atomic.StoreInt32(&t.running, 1)
+	err = t.retry(c, rep)
+	if err != nil {
+		if c.Err() != nil {
+			rep.Status = statusCancelled
+		}
+		return err
+	}
+
+	err = rep.succeed()
+	if err != nil {
+		return err
+	}
+
+	if t.incremental() && !c.DryRun() {
+		err := c.run.build.state.set(t.Name, taskState{Inputs: hash})
+		if err != nil {
+			return err
+		}
+	}
+
+	c.Notice("Done.")
+	return nil
+}
+
+// retry calls the action, and retries it with backoff if it fails.
+func (t *task) retry(c *C, rep *taskReport) error {
+	backoff := t.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	for attempt := 1; ; attempt++ {
+		rep.Attempts = attempt
+		rep.reset()
+		if attempt > 1 {
+			c.Infof("Attempt %d of %d.", attempt, t.Retries+1)
+		}
+
+		err := t.call(c)
+		if err == nil || attempt > t.Retries || c.Err() != nil {
+			return err
+		}
+
+		c.Warnf("Attempt %d failed: %s", attempt, err)
+		c.Infof("Retrying in %s.", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-c.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// call calls the action with the task timeout, if any.
+func (t *task) call(c *C) error {
+	if t.Timeout <= 0 {
+		return t.Action(c)
+	}
+
+	ctx, cancel := context.WithTimeout(c, t.Timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- t.Action(c.WithContext(ctx))
+	}()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		// The action must stop before it is retried or the task is
+		// done, so it never runs twice at once or writes afterwards.
+		cancel()
+		err = t.wait(c, result)
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Timed out after %s.", t.Timeout)
 	}
 	return err
 }
+
+// wait waits for the canceled action to return.
+func (t *task) wait(c *C, result <-chan error) error {
+	for {
+		select {
+		case err := <-result:
+			return err
+		case <-time.After(time.Second):
+			c.Warnf("Still waiting for %s to stop.", t.Name)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package slurp
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunOnce(t *testing.T) {
+	b := NewBuild()
+
+	var runs int32
+	b.Task(
+		Task{
+			Name:   "deps",
+			Usage:  "deps",
+			Action: func(c *C) error { atomic.AddInt32(&runs, 1); return errors.New("deps failed") },
+		},
+		Task{Name: "css", Usage: "css", Deps: []string{"deps"}, Action: func(c *C) error { return nil }},
+		Task{Name: "js", Usage: "js", Deps: []string{"deps"}, Action: func(c *C) error { return nil }},
+		Task{
+			Name:  "default",
+			Usage: "default",
+			Deps:  []string{"css", "js"},
+			Action: func(c *C) error {
+				b.Run(c, "deps")
+				return nil
+			},
+		},
+	)
+
+	b.Run(b.C, "default")
+	if runs != 1 {
+		t.Fatalf("Expected deps to run once, ran %d times.", runs)
+	}
+
+	b.Run(b.C, "css", "js")
+	if runs != 2 {
+		t.Fatalf("Expected deps to run once per invocation, ran %d times.", runs)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	nop := func(c *C) error { return nil }
+
+	b := NewBuild()
+	b.Task(
+		Task{Name: "default", Usage: "default", Deps: []string{"a"}, Action: nop},
+		Task{Name: "a", Usage: "a", Deps: []string{"b"}, Action: nop},
+		Task{Name: "b", Usage: "b", Action: nop},
+	)
+	if err := b.Validate(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for i, name := range []string{"b", "a", "default"} {
+		if b.order[i].Name != name {
+			t.Fatalf("Expected %s at %d in order. Got %s", name, i, b.order[i].Name)
+		}
+	}
+
+	b = NewBuild()
+	b.Task(
+		Task{Name: "a", Usage: "a", Deps: []string{"b", "x"}, Action: nop},
+		Task{Name: "b", Usage: "b", Deps: []string{"c"}, Action: nop},
+		Task{Name: "c", Usage: "c", Deps: []string{"a", "y"}, Action: nop},
+	)
+
+	err, _ := b.Validate().(GraphError)
+	expected := []string{
+		"Missing Task x. Required by Task a.",
+		"Missing Task y. Required by Task c.",
+		"Circular dependency: a -> b -> c -> a",
+	}
+	if len(err) != len(expected) {
+		t.Fatalf("Expected %d errors. Got %v", len(expected), err)
+	}
+	for i, msg := range expected {
+		if err[i].Error() != msg {
+			t.Fatalf("Expected %q. Got %q", msg, err[i])
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	nop := func(c *C) error { return nil }
+
+	deploy := flag.NewFlagSet("deploy", flag.ContinueOnError)
+	env := deploy.String("env", "dev", "deploy environment")
+
+	b := NewBuild()
+	b.Task(
+		Task{Name: "deploy", Usage: "deploy", Flags: deploy, Action: nop},
+		Task{Name: "build", Usage: "build", Action: nop},
+	)
+
+	tasks, err := b.parse([]string{"deploy", "-env=staging", "build"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(tasks) != 2 || tasks[0] != "deploy" || tasks[1] != "build" {
+		t.Fatalf("Expected [deploy build]. Got %v", tasks)
+	}
+	if *env != "staging" {
+		t.Fatalf("Expected env staging. Got %s", *env)
+	}
+
+	if _, err := b.parse([]string{"build", "-minify"}); err == nil {
+		t.Fatal("Expected error for undefined flag.")
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	os.Chdir(t.TempDir())
+
+	ioutil.WriteFile("input.txt", []byte("input"), 0644)
+
+	var runs int
+	b := NewBuild()
+	b.Task(Task{
+		Name:    "copy",
+		Usage:   "copy",
+		Inputs:  []string{"*.txt"},
+		Outputs: []string{"public"},
+		Action: func(c *C) error {
+			runs++
+			os.MkdirAll("public", 0755)
+			return ioutil.WriteFile("public/output", []byte("output"), 0644)
+		},
+	})
+
+	for i, expected := range []int{1, 1, 2} {
+		if i == 2 {
+			os.RemoveAll("public")
+		}
+		b.Run(b.C, "copy")
+		if runs != expected {
+			t.Fatalf("Expected %d runs after invocation %d. Got %d", expected, i+1, runs)
+		}
+	}
+}
+
+func TestIncrementalInputs(t *testing.T) {
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	os.Chdir(t.TempDir())
+
+	os.MkdirAll("src", 0755)
+	os.MkdirAll("public", 0755)
+	ioutil.WriteFile("src/a.css", []byte("a"), 0644)
+
+	var runs, fails int
+	b := NewBuild()
+	b.Task(
+		Task{
+			Name:    "dir",
+			Usage:   "dir",
+			Inputs:  []string{"src"},
+			Outputs: []string{"public"},
+			Action: func(c *C) error {
+				runs++
+				return ioutil.WriteFile("public/a.css", []byte("a"), 0644)
+			},
+		},
+		Task{
+			Name:    "typo",
+			Usage:   "typo",
+			Inputs:  []string{"scr/*.css"},
+			Outputs: []string{"public"},
+			Action:  func(c *C) error { fails++; return nil },
+		},
+		Task{
+			Name:    "failing",
+			Usage:   "failing",
+			Inputs:  []string{"src"},
+			Outputs: []string{"public"},
+			Action:  func(c *C) error { fails++; return errors.New("half written") },
+		},
+	)
+
+	b.Run(b.C, "dir")
+	// Newer than the output.
+	later := time.Now().Add(time.Minute)
+	ioutil.WriteFile("src/a.css", []byte("b"), 0644)
+	os.Chtimes("src/a.css", later, later)
+	b.Run(b.C, "dir")
+	if runs != 2 {
+		t.Fatalf("Expected dir to run again after its input changed. Got %d runs", runs)
+	}
+
+	b.KeepGoing = true
+	for i := 0; i < 2; i++ {
+		b.Run(b.C, "typo")
+		b.Run(b.C, "failing")
+	}
+	if fails != 4 {
+		t.Fatalf("Expected typo and failing to run every time. Got %d runs", fails)
+	}
+}
+
+func TestReport(t *testing.T) {
+	b := NewBuild()
+	b.Task(
+		Task{Name: "a", Usage: "a", Action: func(c *C) error {
+			src := make(chan File)
+			go func() {
+				defer close(src)
+				src <- c.Track(File{Reader: strings.NewReader("one")})
+				src <- c.Track(File{Reader: strings.NewReader("two")})
+			}()
+			// One more file made by the stage.
+			concat := func(in <-chan File, out chan<- File) {
+				for f := range in {
+					f.Close()
+				}
+				out <- File{Reader: strings.NewReader("onetwo")}
+			}
+			return Pipe(src).Then(concat)
+		}},
+		Task{Name: "b", Usage: "b", Action: func(c *C) error { return errors.New("b failed") }},
+		Task{Name: "default", Usage: "default", Deps: []string{"a", "b"}, Action: func(c *C) error { return nil }},
+		Task{Name: "slow", Usage: "slow", Action: func(c *C) error { time.Sleep(20 * time.Millisecond); return nil }},
+		Task{Name: "c", Usage: "c", Deps: []string{"slow"}, Action: func(c *C) error { return nil }},
+	)
+
+	b.KeepGoing = true
+	r := newRun(b, b.C)
+	b.Run(r.c, "default", "c")
+
+	statuses := make(map[string]*taskReport)
+	for _, rep := range r.report.tasks {
+		statuses[rep.Name] = rep
+	}
+
+	for name, status := range map[string]string{"a": statusOK, "b": statusFailed, "default": statusCancelled} {
+		if statuses[name] == nil || statuses[name].Status != status {
+			t.Fatalf("Expected %s to be %s. Got %+v", name, status, statuses[name])
+		}
+	}
+	if statuses["a"].Files != 3 {
+		t.Fatalf("Expected 3 files for a. Got %d", statuses["a"].Files)
+	}
+	if statuses["c"].Start.Before(statuses["slow"].End) {
+		t.Fatalf("Expected c to start after its dependencies. Got %+v", statuses["c"])
+	}
+}
+
+func TestKeepGoing(t *testing.T) {
+	for _, keepgoing := range []bool{false, true} {
+		b := NewBuild()
+		b.KeepGoing = keepgoing
+		b.Task(
+			Task{Name: "bad", Usage: "bad", Action: func(c *C) error { return errors.New("bad failed") }},
+			Task{Name: "slow", Usage: "slow", Action: func(c *C) error {
+				select {
+				case <-c.Done():
+					return c.Err()
+				case <-time.After(50 * time.Millisecond):
+					return nil
+				}
+			}},
+			Task{Name: "default", Usage: "default", Deps: []string{"bad", "slow"}, Action: func(c *C) error { return nil }},
+		)
+
+		r := newRun(b, b.C)
+		b.Run(r.c, "default")
+
+		expected := statusCancelled
+		if keepgoing {
+			expected = statusOK
+		}
+		for _, rep := range r.report.tasks {
+			if rep.Name == "slow" && rep.Status != expected {
+				t.Fatalf("Expected slow to be %s with KeepGoing %v. Got %s", expected, keepgoing, rep.Status)
+			}
+		}
+
+		failed := r.report.failed()
+		if len(failed) != 1 || failed[0].Name != "bad" {
+			t.Fatalf("Expected only bad to fail. Got %+v", failed)
+		}
+	}
+}
+
+func TestLevels(t *testing.T) {
+	nop := func(c *C) error { return nil }
+
+	b := NewBuild()
+	b.Task(
+		Task{Name: "default", Usage: "default", Deps: []string{"css", "js"}, Action: nop},
+		Task{Name: "css", Usage: "css", Deps: []string{"deps"}, Action: nop},
+		Task{Name: "js", Usage: "js", Deps: []string{"deps", "lint"}, Action: nop},
+		Task{Name: "deps", Usage: "deps", Action: nop},
+		Task{Name: "lint", Usage: "lint", Action: nop},
+		Task{Name: "other", Usage: "other", Action: nop},
+	)
+	b.Validate()
+
+	levels := fmt.Sprint(b.levels("default"))
+	if levels != "[[deps lint] [css js] [default]]" {
+		t.Fatalf("Unexpected levels: %s", levels)
+	}
+}
+
+func TestTree(t *testing.T) {
+	nop := func(c *C) error { return nil }
+
+	b := NewBuild()
+	b.Task(
+		Task{Name: "default", Usage: "default", Deps: []string{"css", "js"}, Action: nop},
+		Task{Name: "css", Usage: "css", Deps: []string{"deps"}, Action: nop},
+		Task{Name: "js", Usage: "js", Deps: []string{"deps"}, Action: nop},
+		Task{Name: "deps", Usage: "deps", Action: nop},
+	)
+
+	buf := new(bytes.Buffer)
+	b.Tree(buf, "default")
+	expected := "default\n|-- css\n|   `-- deps\n`-- js\n    `-- deps\n"
+	if buf.String() != expected {
+		t.Fatalf("Expected:\n%sGot:\n%s", expected, buf)
+	}
+
+	buf.Reset()
+	b.Dot(buf)
+	if !strings.Contains(buf.String(), "\t\"default\" -> \"css\";\n") {
+		t.Fatalf("Missing edge in:\n%s", buf)
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	var attempts int
+	var running int32
+	var overlapped bool
+	b := NewBuild()
+	b.Task(
+		Task{
+			Name:    "flaky",
+			Usage:   "flaky",
+			Retries: 2,
+			Backoff: time.Millisecond,
+			Action: func(c *C) error {
+				attempts++
+				if attempts < 3 {
+					return errors.New("try again")
+				}
+				return nil
+			},
+		},
+		Task{
+			Name:    "hang",
+			Usage:   "hang",
+			Timeout: 10 * time.Millisecond,
+			Action: func(c *C) error {
+				<-c.Done()
+				return c.Err()
+			},
+		},
+		Task{
+			Name:    "slow",
+			Usage:   "slow",
+			Timeout: 10 * time.Millisecond,
+			Retries: 1,
+			Backoff: time.Millisecond,
+			Action: func(c *C) error {
+				if atomic.AddInt32(&running, 1) > 1 {
+					overlapped = true
+				}
+				defer atomic.AddInt32(&running, -1)
+				<-c.Done()
+				// Takes a while to stop.
+				time.Sleep(20 * time.Millisecond)
+				return c.Err()
+			},
+		},
+	)
+
+	r := newRun(b, b.C)
+	if err := r.do(b.Tasks["flaky"]); err != nil || attempts != 3 {
+		t.Fatalf("Expected flaky to succeed on the 3rd attempt. Got %v after %d", err, attempts)
+	}
+
+	err := r.do(b.Tasks["hang"])
+	if err == nil || err.Error() != "Timed out after 10ms." {
+		t.Fatalf("Expected timeout error. Got %v", err)
+	}
+	// The failure of hang canceled the run.
+	r = newRun(b, b.C)
+	err = r.do(b.Tasks["slow"])
+	if err == nil || overlapped || atomic.LoadInt32(&running) != 0 {
+		t.Fatalf("Expected the attempts of slow to run one at a time. Got %v", err)
+	}
+}
+
+func TestOnSuccess(t *testing.T) {
+	var calls []string
+	attempt := 0
+
+	b := NewBuild()
+	b.Task(
+		Task{Name: "flaky", Usage: "flaky", Retries: 1, Backoff: time.Millisecond, Action: func(c *C) error {
+			attempt++
+			n := attempt
+			c.OnSuccess(func() error { calls = append(calls, fmt.Sprintf("flaky %d", n)); return nil })
+			if n == 1 {
+				return errors.New("try again")
+			}
+			return nil
+		}},
+		Task{Name: "bad", Usage: "bad", Action: func(c *C) error {
+			c.OnSuccess(func() error { calls = append(calls, "bad"); return nil })
+			return errors.New("bad failed")
+		}},
+	)
+
+	b.KeepGoing = true
+	r := newRun(b, b.C)
+	b.Run(r.c, "flaky", "bad")
+
+	if len(calls) != 1 || calls[0] != "flaky 2" {
+		t.Fatalf("Expected only the successful attempt of flaky. Got %v", calls)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var ran []string
+	var lock sync.Mutex
+	action := func(name string) Action {
+		return func(c *C) error {
+			lock.Lock()
+			defer lock.Unlock()
+			ran = append(ran, name)
+			return nil
+		}
+	}
+
+	b := NewBuild()
+	b.C.dryrun = true
+	b.Task(
+		Task{Name: "deps", Usage: "deps", Action: action("deps")},
+		Task{Name: "default", Usage: "default", Deps: []string{"deps"}, DryRun: true, Action: action("default")},
+	)
+	b.Run(b.C, "default")
+
+	if len(ran) != 1 || ran[0] != "default" {
+		t.Fatalf("Expected only the action of default to run. Got %v", ran)
+	}
+}
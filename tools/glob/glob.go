@@ -1,6 +1,7 @@
 package glob
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
@@ -58,7 +59,8 @@ func Excluded(patterns []pattern, name string) bool {
 // is performed starting at the directory determined by the path before it,
 // and each file name is checked against the path after it.
 // Otherwise, a standard filepath.Glob() is used.
-func doGlob(glob string) ([]string, error) {
+// The walk stops early if ctx is canceled.
+func doGlob(ctx context.Context, glob string) ([]string, error) {
 	const recurse = string(filepath.Separator)+"**"+string(filepath.Separator)
 	if index := strings.Index(glob, recurse); index != -1 {
 		var (
@@ -66,6 +68,9 @@ func doGlob(glob string) ([]string, error) {
 			results = make([]string, 0)
 		)
 		if err := filepath.Walk(glob[:index], func(path string, info os.FileInfo, _ error) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			m, err := Match(g, info.Name())
 			if err != nil {
 				return err
@@ -84,6 +89,12 @@ func doGlob(glob string) ([]string, error) {
 }
 
 func Glob(globs ...string) (<-chan MatchPair, error) {
+	return GlobContext(context.Background(), globs...)
+}
+
+// GlobContext is like Glob but stops matching, and closes the channel,
+// as soon as ctx is canceled.
+func GlobContext(ctx context.Context, globs ...string) (<-chan MatchPair, error) {
 
 	//defer close(out)
 
@@ -114,7 +125,7 @@ func Glob(globs ...string) (<-chan MatchPair, error) {
 				continue
 			}
 			//Patterns already checked and fs errors are ignored. so no error handling here.
-			files, _ := doGlob(pattern.Glob)
+			files, _ := doGlob(ctx, pattern.Glob)
 
 			for _, file := range files {
 				if _, seen := seen[file]; seen || Excluded(patterns[i:], file) {
@@ -122,7 +133,11 @@ func Glob(globs ...string) (<-chan MatchPair, error) {
 				}
 
 				seen[file] = struct{}{}
-				matches <- MatchPair{pattern.Glob, file}
+				select {
+				case matches <- MatchPair{pattern.Glob, file}:
+				case <-ctx.Done():
+					return
+				}
 			}
 		}
 	}()
@@ -2,6 +2,7 @@
 package http
 
 import (
+	"context"
 	"fmt"
 	"mime"
 	"net/http"
@@ -23,15 +24,27 @@ func name(url string, response *http.Response) string {
 }
 
 func Get(url string) (slurp.File, error) {
+	return GetContext(context.Background(), url)
+}
+
+// GetContext is like Get but the request, including reading the body,
+// is aborted when ctx is canceled.
+func GetContext(ctx context.Context, url string) (slurp.File, error) {
 
 	file := slurp.File{Cwd: "", Dir: ""}
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return file, err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
 	if err != nil {
 		return file, err
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode > 399 {
+		resp.Body.Close()
 		return file, fmt.Errorf("%s (%s)", resp.Status, url)
 	}
 
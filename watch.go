@@ -0,0 +1,166 @@
+package slurp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// WatchInterval is how often watched files are polled for changes.
+	WatchInterval = 300 * time.Millisecond
+	// WatchDelay is how long the watched files must stay unchanged
+	// before the tasks are re-run, so a burst of changes, say a
+	// checkout, triggers a single run.
+	WatchDelay = 500 * time.Millisecond
+)
+
+// Watch runs the tasks and then re-runs them whenever the files that
+// match the globs change, until the build is canceled. A run that is
+// still going when new changes come in is canceled first.
+// The files are polled every WatchInterval.
+func (b *Build) Watch(globs []string, tasks ...string) {
+
+	var (
+		cancel  context.CancelFunc
+		running Waiter
+	)
+
+	start := func() {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(b.C)
+		running = b.Start(b.C.WithContext(ctx), tasks...)
+	}
+
+	stop := func() {
+		cancel()
+		running.Wait()
+	}
+
+	b.Infof("Watching %s for %s", strings.Join(globs, ","), strings.Join(tasks, ","))
+
+	last := snapshot(globs)
+	start()
+
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+
+	var changed time.Time
+	for {
+		select {
+		case <-b.Done():
+			stop()
+			return
+		case <-ticker.C:
+		}
+
+		current := snapshot(globs)
+		if !current.equal(last) {
+			last = current
+			changed = time.Now()
+			continue
+		}
+
+		if changed.IsZero() || time.Since(changed) < WatchDelay {
+			continue
+		}
+		changed = time.Time{}
+
+		b.Infof("Changes detected, running %s", strings.Join(tasks, ","))
+		stop()
+		start()
+	}
+}
+
+// inputs returns the Inputs of the tasks and all of their dependencies.
+func (b *Build) inputs(tasks ...string) []string {
+	seen := make(map[string]bool)
+	var globs []string
+
+	var visit func(name string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		t, ok := b.Tasks[name]
+		if !ok {
+			return
+		}
+		globs = append(globs, t.Inputs...)
+		for _, dep := range t.Deps {
+			visit(dep)
+		}
+	}
+
+	for _, name := range tasks {
+		visit(name)
+	}
+	return globs
+}
+
+// watch watches the inputs of each task and re-runs it on changes.
+// It fails without watching anything if any of the tasks has no Inputs
+// in its dependency tree.
+func (b *Build) watch(tasks ...string) error {
+	inputs := make(map[string][]string)
+	for _, name := range tasks {
+		globs := b.inputs(name)
+		if len(globs) == 0 {
+			return fmt.Errorf("Task %s has no Inputs to watch.", name)
+		}
+		inputs[name] = globs
+	}
+
+	var wg sync.WaitGroup
+	for name, globs := range inputs {
+		wg.Add(1)
+		go func(name string, globs []string) {
+			defer wg.Done()
+			b.Watch(globs, name)
+		}(name, globs)
+	}
+	wg.Wait()
+	return nil
+}
+
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+type stamps map[string]stamp
+
+// snapshot stamps the files that match the globs, including the files
+// under the matching directories, just like the Inputs of a task.
+func snapshot(globs []string) stamps {
+	s := make(stamps)
+	files, err := match(globs)
+	if err != nil {
+		return s
+	}
+	for _, name := range files {
+		info, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		s[name] = stamp{info.ModTime(), info.Size()}
+	}
+	return s
+}
+
+func (s stamps) equal(other stamps) bool {
+	if len(s) != len(other) {
+		return false
+	}
+	for name, st := range s {
+		o, ok := other[name]
+		if !ok || !o.modTime.Equal(st.modTime) || o.size != st.size {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package slurp
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchNoInputs(t *testing.T) {
+	b := NewBuild()
+	b.Task(
+		Task{Name: "deps", Usage: "deps", Action: func(c *C) error { return nil }},
+		Task{Name: "build", Usage: "build", Deps: []string{"deps"}, Action: func(c *C) error { return nil }},
+	)
+
+	if err := b.watch("build"); err == nil {
+		t.Fatal("Expected an error for a task without Inputs.")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	interval, delay := WatchInterval, WatchDelay
+	t.Cleanup(func() { WatchInterval, WatchDelay = interval, delay })
+	WatchInterval = 10 * time.Millisecond
+	WatchDelay = 20 * time.Millisecond
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.txt")
+	ioutil.WriteFile(input, []byte("a"), 0644)
+
+	var runs int32
+	b := NewBuild()
+	b.Task(Task{
+		Name:   "build",
+		Usage:  "build",
+		Action: func(c *C) error { atomic.AddInt32(&runs, 1); return nil },
+	})
+
+	done := make(chan struct{})
+	go func() {
+		b.Watch([]string{filepath.Join(dir, "*.txt")}, "build")
+		close(done)
+	}()
+
+	wait := func(n int32) {
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt32(&runs) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d runs. Got %d", n, atomic.LoadInt32(&runs))
+			}
+			time.Sleep(WatchInterval)
+		}
+	}
+
+	wait(1)
+	ioutil.WriteFile(input, []byte("ab"), 0644)
+	wait(2)
+
+	b.Cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch didn't return after the build was canceled.")
+	}
+}